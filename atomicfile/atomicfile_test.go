@@ -0,0 +1,94 @@
+package atomicfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []byte
+		data     []byte
+		perm     os.FileMode
+	}{
+		{"new file", nil, []byte("192.0.2.1\n"), 0644},
+		{"replace file", []byte("192.0.2.1\n"), []byte("192.0.2.2\n"), 0644},
+		{"replace longer file", []byte("2001:db8::1\n"), []byte("::1\n"), 0600},
+		{"empty data", []byte("192.0.2.1\n"), []byte{}, 0640},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "address")
+			if test.existing != nil {
+				err := os.WriteFile(name, test.existing, 0666)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := WriteFile(name, test.data, test.perm)
+			if err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, test.data) {
+				t.Errorf("content = %q, want %q", data, test.data)
+			}
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runtime.GOOS != "windows" && info.Mode().Perm() != test.perm {
+				t.Errorf("permissions = %o, want %o", info.Mode().Perm(), test.perm)
+			}
+			assertOnlyFile(t, dir, "address")
+		})
+	}
+}
+
+func TestWriteFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	err := WriteFile(filepath.Join(dir, "missing", "address"), []byte("192.0.2.1\n"), 0644)
+	if err == nil {
+		t.Fatal("WriteFile() into a missing directory succeeded")
+	}
+	assertOnlyFile(t, dir, "")
+}
+
+func TestWriteFileOverDirectory(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "address")
+	err := os.Mkdir(name, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFile(name, []byte("192.0.2.1\n"), 0644)
+	if err == nil {
+		t.Fatal("WriteFile() over a directory succeeded")
+	}
+	assertOnlyFile(t, dir, "address")
+}
+
+// assertOnlyFile checks that no temporary file is left in dir, which only
+// contains the file name, or nothing if name is empty.
+func assertOnlyFile(t *testing.T, dir, name string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if name == "" && len(names) != 0 || name != "" && (len(names) != 1 || names[0] != name) {
+		t.Errorf("directory contains %q, want only %q", names, name)
+	}
+}
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"github.com/zhouchenh/active-ddns/doublable"
 	"github.com/zhouchenh/active-ddns/logger"
 	"github.com/zhouchenh/active-ddns/neterr"
@@ -9,103 +11,248 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"os"
+	"sync"
 	"time"
 )
 
+type Endpoint struct {
+	Addr       string
+	ServerName string
+}
+
+// Update is an address to be published. Host is empty for the address
+// reported by the server, and names the LAN host otherwise. OldIPAddr is nil
+// if no address of the family has been published before. ID is shared by the
+// updates derived from the same address, and by their retries.
+type Update struct {
+	ID        string
+	Host      string
+	Family    string
+	IPAddr    net.IP
+	OldIPAddr net.IP
+	Server    string
+	Time      time.Time
+}
+
+// errSessionsEnded is returned by Run if it stops keeping sessions with the
+// servers, which it is not meant to do.
+var errSessionsEnded = errors.New("sessions with the servers ended")
+
 type Client struct {
-	ConnectAddr             string
+	Endpoints               []Endpoint
+	Discovery               string
+	Network                 string
+	HappyEyeballs           bool
+	LocalAddr               string
+	Interface               string
+	Mark                    int
+	NetNS                   string
 	NoTLS                   bool
 	AllowInsecureTLS        bool
-	ServerName              string
+	Certificate             *tls.Certificate
 	HeartbeatInterval       time.Duration
 	MissedHeartbeatsAllowed int
 	idleTimeout             time.Duration
 	RedialInterval          *doublable.Duration
-	currentIPAddr           net.IP
-	OnIPAddrUpdate          func(newIPAddr net.IP)
+	Failover                string
+	FailoverAfter           int
+	PreferInterval          time.Duration
+	Quorum                  int
+	quorum                  *quorum
+	RetryInterval           *doublable.Duration
+	MaxRetries              int
+	StateFile               string
+	Published               []net.IP
+	state                   state
+	StableDuration          time.Duration
+	StableSessions          int
+	stabilizer              *stabilizer
+	updater                 *updater
+	sessionMutex            sync.Mutex
+	sessions                map[net.Conn]struct{}
+	redial                  chan struct{}
+	PrefixLength            int
+	Hosts                   []Host
+	OnIPAddrReport          func(update *Update)
+	OnIPAddrUpdate          func(ctx context.Context, update *Update) error
+	OutageThreshold         time.Duration
+	OnEvent                 func(event *Event)
 }
 
 func (c *Client) Run() (err error) {
 	c.idleTimeout = c.HeartbeatInterval/2 + c.HeartbeatInterval + time.Duration(c.MissedHeartbeatsAllowed)*c.HeartbeatInterval
-	_, err = net.ResolveTCPAddr("tcp", c.ConnectAddr)
-	if err != nil {
-		return err
+	if len(c.Endpoints) == 0 && c.Discovery == "" {
+		return errors.New("no server specified")
 	}
-	var dial func() (net.Conn, error)
-	if c.NoTLS {
-		dial = func() (net.Conn, error) {
-			return net.Dial("tcp", c.ConnectAddr)
-		}
-	} else {
-		config := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.AllowInsecureTLS}
-		dial = func() (net.Conn, error) {
-			return tls.Dial("tcp", c.ConnectAddr, config)
+	if (c.Interface != "" || c.Mark != 0) && !sockoptsSupported {
+		return errors.New("binding to an interface or setting a mark is not supported on this platform")
+	}
+	if c.NetNS != "" && !netnsSupported {
+		return errors.New("network namespaces are not supported on this platform")
+	}
+	for _, ep := range c.Endpoints {
+		_, err = net.ResolveTCPAddr("tcp", ep.Addr)
+		if err != nil {
+			return err
 		}
 	}
+	c.sessionMutex.Lock()
+	c.sessions = make(map[net.Conn]struct{})
+	c.redial = make(chan struct{})
+	c.sessionMutex.Unlock()
+	c.loadState()
+	c.seedPublished()
+	c.updater = newUpdater(c)
+	go c.updater.run()
+	c.stabilizer = newStabilizer(c)
+	c.quorum = newQuorum(c)
+	if c.Failover != "" || c.Discovery != "" {
+		c.keepFailoverSession()
+		return errSessionsEnded
+	}
+	for _, ep := range c.Endpoints[1:] {
+		go c.keepSession(ep)
+	}
+	c.keepSession(c.Endpoints[0])
+	return errSessionsEnded
+}
+
+func (c *Client) keepSession(ep Endpoint) {
+	redialInterval := *c.RedialInterval
+	var o outage
 	for {
-		conn, err := dial()
+		conn, err := c.dial(ep)
 		if err != nil {
 			neterr.LogError(err)
-			c.RedialInterval.Double()
-			ri := c.RedialInterval.Duration()
-			logger.Info().Str("duration", ri.String()).Msg("Waiting for reconnection")
-			time.Sleep(ri)
+			c.serverUnreachable(ep, &o, time.Now())
+			redialInterval.Double()
+			ri := redialInterval.Duration()
+			logger.Info().Str("server", ep.Addr).Str("duration", ri.String()).Msg("Waiting for reconnection")
+			if c.wait(ri) {
+				redialInterval.Minimize()
+			}
 			continue
 		}
-		c.RedialInterval.Minimize()
-		c.handleConn(conn)
+		redialInterval.Minimize()
+		c.handleConn(ep, conn, &o)
 	}
 }
 
-func (c *Client) handleConn(conn net.Conn) {
+// Redial closes the current sessions and makes the client reconnect at once,
+// without waiting for the redial interval.
+func (c *Client) Redial() {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+	if c.redial == nil {
+		return
+	}
+	close(c.redial)
+	c.redial = make(chan struct{})
+	for conn := range c.sessions {
+		_ = conn.Close()
+	}
+}
+
+// wait waits for d to elapse, and reports whether it was interrupted by
+// Redial.
+func (c *Client) wait(d time.Duration) bool {
+	c.sessionMutex.Lock()
+	redial := c.redial
+	c.sessionMutex.Unlock()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return false
+	case <-redial:
+		return true
+	}
+}
+
+// handleConn keeps the session on conn until it ends, and tracks the outage o
+// of the server: a session in which the server reports the address ends an
+// outage, and one which times out starts one.
+func (c *Client) handleConn(ep Endpoint, conn net.Conn, o *outage) {
 	defer conn.Close()
+	c.sessionMutex.Lock()
+	c.sessions[conn] = struct{}{}
+	c.sessionMutex.Unlock()
+	defer func() {
+		c.sessionMutex.Lock()
+		delete(c.sessions, conn)
+		c.sessionMutex.Unlock()
+	}()
 	remoteAddr := conn.RemoteAddr().String()
 	defer logger.Info().Str("server", remoteAddr).Msg("Disconnected")
-	logger.Info().Str("server", remoteAddr).Msg("Connected")
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		logger.Info().Str("server", remoteAddr).Str("family", Family(tcpAddr.IP)).Msg("Connected")
+	} else {
+		logger.Info().Str("server", remoteAddr).Msg("Connected")
+	}
+	connected := time.Now()
+	ip, err := c.readIPAddr(conn)
+	if err != nil {
+		var protocolErr *ProtocolError
+		if errors.As(err, &protocolErr) {
+			logger.Warning().Str("server", remoteAddr).Int("length", protocolErr.Length).Msg("Received invalid data")
+		} else {
+			neterr.LogError(err)
+		}
+		if os.IsTimeout(err) {
+			c.serverUnreachable(ep, o, connected)
+		}
+		return
+	}
+	c.serverReachable(ep, o)
+	logger.Debug().Str("server", remoteAddr).Str("address", ip.String()).Msg("Received IP address")
+	session := Update{Family: Family(ip), IPAddr: ip, Server: ep.Addr}
+	c.emit(&Event{Type: EventConnected, Update: session})
+	defer c.emit(&Event{Type: EventDisconnected, Update: session})
+	if c.acceptsFamily(ip) {
+		c.quorum.report(ep.Addr, ip)
+		defer c.quorum.withdraw(ep.Addr)
+	} else {
+		logger.Warning().Str("server", remoteAddr).Str("address", ip.String()).Str("network", c.network()).Msg("Received IP address of unexpected family")
+	}
+	t := ticker.NewTicker(c.HeartbeatInterval)
+	defer t.Stop()
+	go c.sendHeartbeats(conn, t, remoteAddr)
+	lastHeard, err := c.receiveHeartbeats(conn, remoteAddr)
+	if os.IsTimeout(err) {
+		c.serverUnreachable(ep, o, lastHeard)
+	}
+}
+
+// readIPAddr reads the address frame, which is the length of the address in
+// one byte followed by the address, sent by the server at the beginning of a
+// session.
+func (c *Client) readIPAddr(conn net.Conn) (net.IP, error) {
 	buffer := make([]byte, net.IPv6len)
 	err := conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
 	if err != nil {
-		neterr.LogError(err)
-		return
+		return nil, err
 	}
 	_, err = conn.Read(buffer[:1])
 	if err != nil {
-		neterr.LogError(err)
-		return
+		return nil, err
 	}
 	if buffer[0] != net.IPv4len && buffer[0] != net.IPv6len {
-		logger.Warning().Str("server", remoteAddr).Int("length", int(buffer[0])).Msg("Received invalid data")
-		return
+		return nil, &ProtocolError{Length: int(buffer[0])}
 	}
 	length := int(buffer[0])
 	for read := 0; read < length; {
 		err := conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
 		if err != nil {
-			neterr.LogError(err)
-			return
+			return nil, err
 		}
 		n, err := conn.Read(buffer[read:length])
 		if err != nil {
-			neterr.LogError(err)
-			return
+			return nil, err
 		}
 		read += n
 	}
-	ip := net.IP(buffer[:length])
-	logger.Debug().Str("server", remoteAddr).Str("address", ip.String()).Msg("Received IP address")
-	go c.onIPAddrReceived(ip)
-	t := ticker.NewTicker(c.HeartbeatInterval)
-	defer t.Stop()
-	go c.sendHeartbeats(conn, t, remoteAddr)
-	c.receiveHeartbeats(conn, remoteAddr)
-}
-
-func (c *Client) onIPAddrReceived(ip net.IP) {
-	if ip.Equal(c.currentIPAddr) {
-		return
-	}
-	c.currentIPAddr = ip
-	c.OnIPAddrUpdate(ip)
+	return net.IP(buffer[:length]), nil
 }
 
 func (c *Client) sendHeartbeats(conn net.Conn, t *ticker.Ticker, remoteAddr string) {
@@ -133,19 +280,24 @@ func (c *Client) sendHeartbeats(conn net.Conn, t *ticker.Ticker, remoteAddr stri
 	}
 }
 
-func (c *Client) receiveHeartbeats(conn net.Conn, remoteAddr string) {
+// receiveHeartbeats reads the heartbeats from the server until the session
+// ends, and returns the error ending it and the time the server was last heard
+// from.
+func (c *Client) receiveHeartbeats(conn net.Conn, remoteAddr string) (lastHeard time.Time, err error) {
 	buffer := make([]byte, 1)
+	lastHeard = time.Now()
 	for {
-		err := conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		err = conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
 		if err != nil {
 			neterr.LogError(err)
-			return
+			return lastHeard, err
 		}
 		_, err = conn.Read(buffer)
 		if err != nil {
 			neterr.LogError(err)
-			return
+			return lastHeard, err
 		}
+		lastHeard = time.Now()
 		if buffer[0] == 0 {
 			logger.Debug().Str("server", remoteAddr).Msg("Received Heartbeat")
 			continue
@@ -153,12 +305,12 @@ func (c *Client) receiveHeartbeats(conn net.Conn, remoteAddr string) {
 		err = conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
 		if err != nil {
 			neterr.LogError(err)
-			return
+			return lastHeard, err
 		}
 		_, err = io.CopyN(ioutil.Discard, conn, int64(buffer[0]))
 		if err != nil {
 			neterr.LogError(err)
-			return
+			return lastHeard, err
 		}
 		logger.Warning().Str("server", remoteAddr).Int("length", int(buffer[0])).Msg("Received invalid data")
 	}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+func (c *Client) dial(ep Endpoint) (conn net.Conn, err error) {
+	conn, err = c.dialTCP(ep)
+	if err != nil || c.NoTLS {
+		return
+	}
+	config := &tls.Config{ServerName: ep.ServerName, InsecureSkipVerify: c.AllowInsecureTLS}
+	if c.Certificate != nil {
+		config.Certificates = []tls.Certificate{*c.Certificate}
+	}
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.Handshake()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialTCP connects to ep without the TLS handshake.
+func (c *Client) dialTCP(ep Endpoint) (net.Conn, error) {
+	if c.HappyEyeballs {
+		return c.dialHappyEyeballs(context.Background(), ep.Addr)
+	}
+	return c.dialAddr(context.Background(), ep.Addr)
+}
+
+func (c *Client) dialAddr(ctx context.Context, address string) (net.Conn, error) {
+	dialer := net.Dialer{Control: c.control}
+	if ip := net.ParseIP(c.LocalAddr); ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if c.NetNS != "" {
+		return c.dialInNetNS(ctx, &dialer, c.network(), address)
+	}
+	return dialer.DialContext(ctx, c.network(), address)
+}
+
+// lookupIP looks host up from inside the network namespace at NetNS if it is
+// specified.
+func (c *Client) lookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if c.NetNS != "" {
+		return c.lookupInNetNS(ctx, network, host)
+	}
+	return net.DefaultResolver.LookupIP(ctx, network, host)
+}
+
+// lookupSRV looks the SRV records of name up from inside the network namespace
+// at NetNS if it is specified.
+func (c *Client) lookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, error) {
+	if c.NetNS != "" {
+		return c.lookupSRVInNetNS(ctx, service, proto, name)
+	}
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+	return records, err
+}
+
+// network returns the network to dial, which is restricted to the family of
+// the local address if one is specified.
+func (c *Client) network() string {
+	if c.Network != "" && c.Network != "tcp" {
+		return c.Network
+	}
+	if ip := net.ParseIP(c.LocalAddr); ip != nil {
+		if ip.To4() != nil {
+			return "tcp4"
+		}
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// acceptsFamily reports whether ip belongs to the address family the client
+// is restricted to.
+func (c *Client) acceptsFamily(ip net.IP) bool {
+	switch c.network() {
+	case "tcp4":
+		return ip.To4() != nil
+	case "tcp6":
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	srvService = "active-ddns"
+	srvProto   = "tcp"
+)
+
+// discoverEndpoints looks up the _active-ddns._tcp SRV records of the
+// discovery domain. The endpoints are ordered by priority and randomized by
+// weight within the same priority, and each target is used as the server name.
+func (c *Client) discoverEndpoints() ([]Endpoint, error) {
+	records, err := c.lookupSRV(context.Background(), srvService, srvProto, c.Discovery)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := srvEndpoints(records)
+	if len(endpoints) == 0 {
+		return nil, errors.New("no server is available")
+	}
+	for _, ep := range endpoints {
+		logger.Debug().Str("domain", c.Discovery).Str("server", ep.Addr).Msg("Discovered server")
+	}
+	return endpoints, nil
+}
+
+// srvEndpoints returns the endpoints of the SRV records in their order. The
+// records whose target is "." are skipped, since they mean that the service is
+// not available.
+func srvEndpoints(records []*net.SRV) []Endpoint {
+	var endpoints []Endpoint
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		if target == "" {
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{
+			Addr:       net.JoinHostPort(target, strconv.Itoa(int(record.Port))),
+			ServerName: target,
+		})
+	}
+	return endpoints
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSRVEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []*net.SRV
+		want    []Endpoint
+	}{
+		{"no record", nil, nil},
+		{"service not available", []*net.SRV{{Target: ".", Port: 0}}, nil},
+		{"trailing dot", []*net.SRV{{Target: "a.example.com.", Port: 3000}}, []Endpoint{
+			{Addr: "a.example.com:3000", ServerName: "a.example.com"},
+		}},
+		{"order is kept", []*net.SRV{
+			{Target: "b.example.com.", Port: 3000, Priority: 10},
+			{Target: "a.example.com.", Port: 3001, Priority: 20},
+			{Target: "c.example.com", Port: 3002, Priority: 20},
+		}, []Endpoint{
+			{Addr: "b.example.com:3000", ServerName: "b.example.com"},
+			{Addr: "a.example.com:3001", ServerName: "a.example.com"},
+			{Addr: "c.example.com:3002", ServerName: "c.example.com"},
+		}},
+		{"unavailable target is skipped", []*net.SRV{
+			{Target: ".", Port: 0},
+			{Target: "a.example.com.", Port: 3000},
+		}, []Endpoint{
+			{Addr: "a.example.com:3000", ServerName: "a.example.com"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := srvEndpoints(test.records); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("srvEndpoints() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReselect(t *testing.T) {
+	a, b, c := Endpoint{Addr: "a:3000"}, Endpoint{Addr: "b:3000"}, Endpoint{Addr: "c:3000"}
+	tests := []struct {
+		name       string
+		endpoints  []Endpoint
+		i          int
+		discovered []Endpoint
+		want       int
+	}{
+		{"first discovery", nil, 0, []Endpoint{a, b}, 0},
+		{"same order", []Endpoint{a, b, c}, 1, []Endpoint{a, b, c}, 1},
+		{"server moved", []Endpoint{a, b, c}, 2, []Endpoint{c, a, b}, 0},
+		{"server moved back", []Endpoint{c, a, b}, 0, []Endpoint{a, b, c}, 2},
+		{"server removed", []Endpoint{a, b, c}, 1, []Endpoint{a, c}, 0},
+		{"index out of range", []Endpoint{a}, 1, []Endpoint{a, b}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := reselect(test.endpoints, test.i, test.discovered); got != test.want {
+				t.Errorf("reselect() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
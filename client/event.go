@@ -0,0 +1,71 @@
+package client
+
+import (
+	"github.com/zhouchenh/active-ddns/logger"
+	"time"
+)
+
+const (
+	EventConnected    = "connected"
+	EventDisconnected = "disconnected"
+	EventOutage       = "outage"
+	EventRecovered    = "recovered"
+	EventUpdateFailed = "updatefailed"
+)
+
+// Event is a change in the state of the client reported to OnEvent. The
+// fields of Update which do not apply to the event are left empty. Duration is
+// the time the server has been unreachable for EventOutage and EventRecovered,
+// and Err is the error of the last attempt for EventUpdateFailed. OnEvent is
+// called from the session goroutines, so it should not block.
+type Event struct {
+	Type string
+	Update
+	Duration time.Duration
+	Err      error
+}
+
+func (c *Client) emit(e *Event) {
+	if c.OnEvent == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	c.OnEvent(e)
+}
+
+// outage tracks how long a server has been unreachable.
+type outage struct {
+	since    time.Time
+	reported bool
+}
+
+// serverUnreachable reports an outage once the server has been unreachable for
+// OutageThreshold, counted from since, which is the time of the first failed
+// attempt to connect, or the time the server was last heard from if its
+// session timed out.
+func (c *Client) serverUnreachable(ep Endpoint, o *outage, since time.Time) {
+	if o.since.IsZero() {
+		o.since = since
+	}
+	if c.OutageThreshold <= 0 || o.reported {
+		return
+	}
+	if d := time.Since(o.since); d >= c.OutageThreshold {
+		o.reported = true
+		logger.Warning().Str("server", ep.Addr).Str("duration", d.String()).Msg("Server unreachable")
+		c.emit(&Event{Type: EventOutage, Update: Update{Server: ep.Addr}, Duration: d})
+	}
+}
+
+// serverReachable reports the recovery from an outage of the server. It is
+// called once the server reports the address in a new session.
+func (c *Client) serverReachable(ep Endpoint, o *outage) {
+	if o.reported {
+		d := time.Since(o.since)
+		logger.Info().Str("server", ep.Addr).Str("duration", d.String()).Msg("Server reachable again")
+		c.emit(&Event{Type: EventRecovered, Update: Update{Server: ep.Addr}, Duration: d})
+	}
+	*o = outage{}
+}
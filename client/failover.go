@@ -0,0 +1,146 @@
+package client
+
+import (
+	"github.com/zhouchenh/active-ddns/doublable"
+	"github.com/zhouchenh/active-ddns/logger"
+	"github.com/zhouchenh/active-ddns/neterr"
+	"net"
+	"time"
+)
+
+const (
+	FailoverPriority   = "priority"
+	FailoverRoundRobin = "roundrobin"
+)
+
+type endpointState struct {
+	redialInterval doublable.Duration
+	failures       int
+	retryAt        time.Time
+	outage         outage
+}
+
+// keepFailoverSession keeps a single session with one of the endpoints at a
+// time. The next endpoint is tried after FailoverAfter consecutive failures.
+// With FailoverPriority, the session stays on the first reachable endpoint
+// and returns to a more preferred one once it is reachable again. With
+// FailoverRoundRobin, every new session is made with the next endpoint.
+func (c *Client) keepFailoverSession() {
+	states := make(map[string]*endpointState)
+	redialInterval := *c.RedialInterval
+	var endpoints []Endpoint
+	i := 0
+	for {
+		endpoints, i = c.refreshEndpoints(endpoints, i)
+		if len(endpoints) == 0 {
+			redialInterval.Double()
+			ri := redialInterval.Duration()
+			logger.Info().Str("duration", ri.String()).Msg("Waiting for reconnection")
+			if c.wait(ri) {
+				redialInterval.Minimize()
+			}
+			continue
+		}
+		redialInterval.Minimize()
+		ep := endpoints[i]
+		st := states[ep.Addr]
+		if st == nil {
+			st = &endpointState{redialInterval: *c.RedialInterval}
+			states[ep.Addr] = st
+		}
+		if wait := time.Until(st.retryAt); wait > 0 {
+			logger.Info().Str("server", ep.Addr).Str("duration", wait.String()).Msg("Waiting for reconnection")
+			if c.wait(wait) {
+				st.redialInterval.Minimize()
+			}
+		}
+		conn, err := c.dial(ep)
+		if err != nil {
+			neterr.LogError(err)
+			c.serverUnreachable(ep, &st.outage, time.Now())
+			st.failures++
+			st.redialInterval.Double()
+			st.retryAt = time.Now().Add(st.redialInterval.Duration())
+			if st.failures >= c.FailoverAfter {
+				st.failures = 0
+				i = (i + 1) % len(endpoints)
+				logger.Warning().Str("server", ep.Addr).Str("nextServer", endpoints[i].Addr).Msg("Failing over to the next server")
+			}
+			continue
+		}
+		st.failures = 0
+		st.redialInterval.Minimize()
+		st.retryAt = time.Time{}
+		stop := make(chan struct{})
+		preferred := make(chan int, 1)
+		if c.Failover == FailoverPriority && i > 0 && c.PreferInterval > 0 {
+			go c.probePreferred(endpoints[:i], ep, conn, stop, preferred)
+		}
+		c.handleConn(ep, conn, &st.outage)
+		close(stop)
+		select {
+		case i = <-preferred:
+		default:
+			if c.Failover == FailoverRoundRobin {
+				i = (i + 1) % len(endpoints)
+			}
+		}
+	}
+}
+
+// refreshEndpoints returns the endpoints for the next connection attempt and
+// the index of the endpoint which was selected in the previous list. When
+// the endpoints are discovered, they are resolved again on every call.
+func (c *Client) refreshEndpoints(endpoints []Endpoint, i int) ([]Endpoint, int) {
+	if c.Discovery == "" {
+		return c.Endpoints, i
+	}
+	discovered, err := c.discoverEndpoints()
+	if err != nil {
+		logger.Error().Str("domain", c.Discovery).Err(err).Msg("Failed to discover servers")
+		return endpoints, i
+	}
+	return discovered, reselect(endpoints, i, discovered)
+}
+
+// reselect returns the index in discovered of the endpoint selected at index i
+// of endpoints, so that the session stays with the same server when it is
+// still discovered, or 0 to start over with the most preferred server.
+func reselect(endpoints []Endpoint, i int, discovered []Endpoint) int {
+	if i < len(endpoints) {
+		for j, ep := range discovered {
+			if ep.Addr == endpoints[i].Addr {
+				return j
+			}
+		}
+	}
+	return 0
+}
+
+// probePreferred periodically dials the endpoints preferred over the current
+// one, and closes the current session once one of them is reachable. Only a
+// TCP connection is made, so that a TLS server neither starts a session nor
+// runs its hooks for the probe.
+func (c *Client) probePreferred(endpoints []Endpoint, current Endpoint, conn net.Conn, stop <-chan struct{}, preferred chan<- int) {
+	t := time.NewTicker(c.PreferInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			for i, ep := range endpoints {
+				probe, err := c.dialTCP(ep)
+				if err != nil {
+					logger.Debug().Str("server", ep.Addr).Err(err).Msg("Preferred server is still unreachable")
+					continue
+				}
+				_ = probe.Close()
+				logger.Info().Str("server", ep.Addr).Str("currentServer", current.Addr).Msg("Preferred server is reachable again, switching back")
+				preferred <- i
+				_ = conn.Close()
+				return
+			}
+		}
+	}
+}
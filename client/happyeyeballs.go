@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"time"
+)
+
+const (
+	resolutionDelay        = 50 * time.Millisecond
+	connectionAttemptDelay = 250 * time.Millisecond
+)
+
+type lookupResult struct {
+	network string
+	ips     []net.IP
+	err     error
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialHappyEyeballs connects to address as described in RFC 8305. The AAAA
+// and A records are looked up concurrently. Connection attempts start as soon
+// as the AAAA records are known, or resolutionDelay after the A records if
+// the AAAA records are not known by then. The attempts alternate between the
+// families starting with IPv6, and are started one after another every
+// connectionAttemptDelay, or at once after a failure, until one of them
+// succeeds. Addresses which are looked up later join the remaining attempts.
+func (c *Client) dialHappyEyeballs(ctx context.Context, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return c.dialAddr(ctx, address)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var networks []string
+	switch c.network() {
+	case "tcp4":
+		networks = []string{"ip4"}
+	case "tcp6":
+		networks = []string{"ip6"}
+	default:
+		networks = []string{"ip6", "ip4"}
+	}
+	lookups := make(chan lookupResult, len(networks))
+	for _, network := range networks {
+		go func(network string) {
+			ips, err := c.lookupIP(ctx, network, host)
+			lookups <- lookupResult{network: network, ips: ips, err: err}
+		}(network)
+	}
+	var q attemptQueue
+	results := make(chan dialResult)
+	lookupsPending, pending := len(networks), 0
+	// dialing is set once the attempts may start, and due once the next
+	// attempt should start without waiting for the pending ones.
+	dialing, due := false, false
+	var resolution, nextAttempt <-chan time.Time
+	var lookupErr, dialErr error
+	start := func() {
+		addr := net.JoinHostPort(q.pop().String(), port)
+		pending++
+		logger.Debug().Str("address", addr).Msg("Attempting connection")
+		go func() {
+			conn, err := c.dialAddr(ctx, addr)
+			results <- dialResult{conn: conn, err: err}
+		}()
+		nextAttempt = time.After(connectionAttemptDelay)
+	}
+	for {
+		if !dialing && q.len() > 0 && (lookupsPending == 0 || len(q.ipv6) > 0) {
+			dialing = true
+		}
+		if dialing && q.len() > 0 && (pending == 0 || due) {
+			due = false
+			start()
+		}
+		if lookupsPending == 0 && pending == 0 && q.len() == 0 {
+			switch {
+			case dialErr != nil:
+				return nil, dialErr
+			case lookupErr != nil:
+				return nil, lookupErr
+			default:
+				return nil, errors.New("no suitable address found")
+			}
+		}
+		select {
+		case r := <-lookups:
+			lookupsPending--
+			if r.err != nil {
+				lookupErr = r.err
+			} else if r.network == "ip6" {
+				q.ipv6 = append(q.ipv6, r.ips...)
+			} else {
+				q.ipv4 = append(q.ipv4, r.ips...)
+				// Give the AAAA lookup a short head start once the A records
+				// are known, but do not wait for it any longer.
+				if lookupsPending > 0 && !dialing {
+					resolution = time.After(resolutionDelay)
+				}
+			}
+		case <-resolution:
+			resolution = nil
+			if q.len() > 0 {
+				dialing = true
+			}
+		case <-nextAttempt:
+			nextAttempt = nil
+			due = true
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go closeLosers(results, pending)
+				return r.conn, nil
+			}
+			if dialErr == nil {
+				dialErr = r.err
+			}
+			due = true
+		}
+	}
+}
+
+// attemptQueue holds the addresses which are not attempted yet, and returns
+// them alternating between the families, starting with IPv6.
+type attemptQueue struct {
+	ipv6, ipv4 []net.IP
+	lastIPv6   bool
+}
+
+func (q *attemptQueue) len() int {
+	return len(q.ipv6) + len(q.ipv4)
+}
+
+func (q *attemptQueue) pop() (ip net.IP) {
+	if len(q.ipv6) > 0 && (!q.lastIPv6 || len(q.ipv4) == 0) {
+		ip, q.ipv6, q.lastIPv6 = q.ipv6[0], q.ipv6[1:], true
+	} else {
+		ip, q.ipv4, q.lastIPv6 = q.ipv4[0], q.ipv4[1:], false
+	}
+	return ip
+}
+
+func closeLosers(results <-chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-results; r.conn != nil {
+			_ = r.conn.Close()
+		}
+	}
+}
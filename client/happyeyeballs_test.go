@@ -0,0 +1,52 @@
+package client
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestAttemptQueue(t *testing.T) {
+	v6a, v6b, v6c := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::3")
+	v4a, v4b := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	tests := []struct {
+		name       string
+		ipv6, ipv4 []net.IP
+		want       []net.IP
+	}{
+		{"IPv6 only", []net.IP{v6a, v6b}, nil, []net.IP{v6a, v6b}},
+		{"IPv4 only", nil, []net.IP{v4a, v4b}, []net.IP{v4a, v4b}},
+		{"interleaved", []net.IP{v6a, v6b}, []net.IP{v4a, v4b}, []net.IP{v6a, v4a, v6b, v4b}},
+		{"more IPv6", []net.IP{v6a, v6b, v6c}, []net.IP{v4a}, []net.IP{v6a, v4a, v6b, v6c}},
+		{"more IPv4", []net.IP{v6a}, []net.IP{v4a, v4b}, []net.IP{v6a, v4a, v4b}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := attemptQueue{ipv6: test.ipv6, ipv4: test.ipv4}
+			var got []net.IP
+			for q.len() > 0 {
+				got = append(got, q.pop())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("popped %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestAttemptQueueLateIPv4 checks that the A records looked up after the
+// first IPv6 attempt are interleaved with the remaining IPv6 addresses.
+func TestAttemptQueueLateIPv4(t *testing.T) {
+	v6a, v6b := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	v4a := net.ParseIP("192.0.2.1")
+	q := attemptQueue{ipv6: []net.IP{v6a, v6b}}
+	got := []net.IP{q.pop()}
+	q.ipv4 = append(q.ipv4, v4a)
+	for q.len() > 0 {
+		got = append(got, q.pop())
+	}
+	want := []net.IP{v6a, v4a, v6b}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+const netnsSupported = true
+
+// dialInNetNS dials address from inside the network namespace at NetNS. Only
+// the OS thread running the dial enters the namespace, and it returns to the
+// original namespace afterwards, so the rest of the process, including the
+// scripts it starts, stays where it is. The host is resolved from inside the
+// namespace first, and the resolved addresses are dialed one after another.
+func (c *Client) dialInNetNS(ctx context.Context, dialer *net.Dialer, network, address string) (conn net.Conn, err error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	err = c.inNetNS(func() error {
+		ips, lookupErr := lookupOnThread(ctx, lookupNetwork(network), host)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		var dialErr error
+		for _, ip := range ips {
+			// The address is an IP literal, so the socket is created by the
+			// calling goroutine on the thread in the namespace.
+			conn, dialErr = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if dialErr == nil {
+				return nil
+			}
+		}
+		return dialErr
+	})
+	if err != nil && conn != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, err
+}
+
+// lookupInNetNS looks host up from inside the network namespace at NetNS.
+func (c *Client) lookupInNetNS(ctx context.Context, network, host string) (ips []net.IP, err error) {
+	err = c.inNetNS(func() error {
+		var lookupErr error
+		ips, lookupErr = lookupOnThread(ctx, network, host)
+		return lookupErr
+	})
+	return ips, err
+}
+
+// lookupSRVInNetNS looks the SRV records of name up from inside the network
+// namespace at NetNS.
+func (c *Client) lookupSRVInNetNS(ctx context.Context, service, proto, name string) (records []*net.SRV, err error) {
+	err = c.inNetNS(func() error {
+		return resolveOnThread(ctx, func(ctx context.Context, resolver *net.Resolver) error {
+			var lookupErr error
+			_, records, lookupErr = resolver.LookupSRV(ctx, service, proto, name)
+			return lookupErr
+		})
+	})
+	return records, err
+}
+
+// inNetNS runs f on an OS thread which is in the network namespace at NetNS
+// while f runs.
+func (c *Client) inNetNS(f func() error) error {
+	results := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		restored, err := c.runOnLockedThread(f)
+		if restored {
+			runtime.UnlockOSThread()
+		}
+		// Otherwise the thread is left locked and terminated together with
+		// the goroutine, since it is stuck in the other namespace.
+		results <- err
+	}()
+	return <-results
+}
+
+func (c *Client) runOnLockedThread(f func() error) (restored bool, err error) {
+	origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+	if err != nil {
+		return true, err
+	}
+	defer origin.Close()
+	target, err := os.Open(c.NetNS)
+	if err != nil {
+		return true, err
+	}
+	defer target.Close()
+	err = setns(target)
+	if err != nil {
+		return true, err
+	}
+	err = f()
+	if restoreErr := setns(origin); restoreErr != nil {
+		return false, restoreErr
+	}
+	return true, err
+}
+
+type socketRequest struct {
+	ctx     context.Context
+	network string
+	address string
+	result  chan dialResult
+}
+
+// lookupOnThread looks host up with the Go resolver on the calling thread.
+func lookupOnThread(ctx context.Context, network, host string) (ips []net.IP, err error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	err = resolveOnThread(ctx, func(ctx context.Context, resolver *net.Resolver) error {
+		var lookupErr error
+		ips, lookupErr = resolver.LookupIP(ctx, network, host)
+		return lookupErr
+	})
+	return ips, err
+}
+
+// resolveOnThread runs lookup with the Go resolver. The lookup runs on other
+// goroutines, which may run on threads outside the namespace, so the sockets
+// of its queries are created by the calling goroutine instead, whose thread is
+// locked in the namespace.
+func resolveOnThread(ctx context.Context, lookup func(ctx context.Context, resolver *net.Resolver) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	requests := make(chan socketRequest)
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			r := socketRequest{ctx: ctx, network: network, address: address, result: make(chan dialResult, 1)}
+			select {
+			case requests <- r:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			result := <-r.result
+			return result.conn, result.err
+		},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- lookup(ctx, resolver)
+	}()
+	var dialer net.Dialer
+	for {
+		select {
+		case r := <-requests:
+			conn, err := dialer.DialContext(r.ctx, r.network, r.address)
+			r.result <- dialResult{conn: conn, err: err}
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// lookupNetwork returns the network to look up the addresses of a host to
+// dial on network.
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4":
+		return "ip4"
+	case "tcp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+func setns(f *os.File) error {
+	_, _, errno := syscall.RawSyscall(sysSetns, f.Fd(), syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return os.NewSyscallError("setns "+f.Name(), errno)
+	}
+	return nil
+}
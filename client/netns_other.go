@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+const netnsSupported = false
+
+func (c *Client) dialInNetNS(_ context.Context, _ *net.Dialer, _, _ string) (net.Conn, error) {
+	return nil, errors.New("network namespaces are not supported on this platform")
+}
+
+func (c *Client) lookupInNetNS(_ context.Context, _, _ string) ([]net.IP, error) {
+	return nil, errors.New("network namespaces are not supported on this platform")
+}
+
+func (c *Client) lookupSRVInNetNS(_ context.Context, _, _, _ string) ([]*net.SRV, error) {
+	return nil, errors.New("network namespaces are not supported on this platform")
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net"
+	"time"
+)
+
+// Host is a LAN host whose IPv6 address is made of the delegated prefix and a
+// stable interface identifier.
+type Host struct {
+	Name        string
+	InterfaceID net.IP
+}
+
+// sameAddress reports whether a and b are the same address. IPv6 addresses
+// are only compared up to PrefixLength if it is set, so that a change of the
+// interface identifier alone is not regarded as an address change.
+func (c *Client) sameAddress(a, b net.IP) bool {
+	if c.PrefixLength > 0 && a != nil && b != nil && a.To4() == nil && b.To4() == nil {
+		mask := net.CIDRMask(c.PrefixLength, 8*net.IPv6len)
+		return a.Mask(mask).Equal(b.Mask(mask))
+	}
+	return a.Equal(b)
+}
+
+// updates returns the update of the reported address, followed by the
+// updates of the hosts whose addresses are derived from it.
+func (c *Client) updates(ip, oldIP net.IP, server string) []*Update {
+	now := time.Now()
+	id := newUpdateID()
+	updates := []*Update{{ID: id, Family: Family(ip), IPAddr: ip, OldIPAddr: oldIP, Server: server, Time: now}}
+	if c.PrefixLength == 0 || ip.To4() != nil {
+		return updates
+	}
+	for _, host := range c.Hosts {
+		u := &Update{ID: id, Host: host.Name, Family: Family(ip), IPAddr: deriveAddress(ip, host.InterfaceID, c.PrefixLength), Server: server, Time: now}
+		if oldIP != nil && oldIP.To4() == nil {
+			u.OldIPAddr = deriveAddress(oldIP, host.InterfaceID, c.PrefixLength)
+		}
+		updates = append(updates, u)
+	}
+	return updates
+}
+
+func deriveAddress(prefix, interfaceID net.IP, prefixLength int) net.IP {
+	mask := net.CIDRMask(prefixLength, 8*net.IPv6len)
+	prefix, interfaceID = prefix.To16(), interfaceID.To16()
+	ip := make(net.IP, net.IPv6len)
+	for i := range ip {
+		ip[i] = prefix[i]&mask[i] | interfaceID[i]&^mask[i]
+	}
+	return ip
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDeriveAddress(t *testing.T) {
+	tests := []struct {
+		prefix       string
+		interfaceID  string
+		prefixLength int
+		want         string
+	}{
+		{"2001:db8:1:2::1", "::11:22ff:fe33:4455", 64, "2001:db8:1:2:11:22ff:fe33:4455"},
+		{"2001:db8:1:2:aaaa:bbbb:cccc:dddd", "::11:22ff:fe33:4455", 64, "2001:db8:1:2:11:22ff:fe33:4455"},
+		{"2001:db8:1:2::1", "::1", 64, "2001:db8:1:2::1"},
+		{"2001:db8:1:ab00::1", "::12:2:3:4:5", 56, "2001:db8:1:ab12:2:3:4:5"},
+		{"2001:db8:1:abff::1", "::1:2:3:4:5", 56, "2001:db8:1:ab01:2:3:4:5"},
+		{"2001:db8:1:abcd::1", "::5:2:3:4:5", 60, "2001:db8:1:abc5:2:3:4:5"},
+		{"2001:db8:1:2::1", "2001:db8::11", 128, "2001:db8:1:2::1"},
+		{"2001:db8:1:2::1", "::11", 0, "::11"},
+	}
+	for _, test := range tests {
+		got := deriveAddress(net.ParseIP(test.prefix), net.ParseIP(test.interfaceID), test.prefixLength)
+		if !got.Equal(net.ParseIP(test.want)) {
+			t.Errorf("deriveAddress(%s, %s, %d) = %s, want %s", test.prefix, test.interfaceID, test.prefixLength, got, test.want)
+		}
+	}
+}
+
+func TestSameAddress(t *testing.T) {
+	tests := []struct {
+		a, b         string
+		prefixLength int
+		want         bool
+	}{
+		{"192.0.2.1", "192.0.2.1", 0, true},
+		{"192.0.2.1", "192.0.2.2", 0, false},
+		{"192.0.2.1", "192.0.2.2", 64, false},
+		{"2001:db8:1:2::1", "2001:db8:1:2::1", 0, true},
+		{"2001:db8:1:2::1", "2001:db8:1:2::2", 0, false},
+		{"2001:db8:1:2::1", "2001:db8:1:2::2", 64, true},
+		{"2001:db8:1:2::1", "2001:db8:1:3::1", 64, false},
+		{"2001:db8:1:2::1", "2001:db8:1:3::1", 56, true},
+		{"2001:db8:1:2::1", "192.0.2.1", 64, false},
+		{"2001:db8:1:2::1", "", 64, false},
+	}
+	for _, test := range tests {
+		c := &Client{PrefixLength: test.prefixLength}
+		if got := c.sameAddress(net.ParseIP(test.a), net.ParseIP(test.b)); got != test.want {
+			t.Errorf("sameAddress(%s, %s) with prefix length %d = %t, want %t", test.a, test.b, test.prefixLength, got, test.want)
+		}
+	}
+}
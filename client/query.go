@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/zhouchenh/active-ddns/logger"
+	"io"
+	"net"
+	"time"
+)
+
+// ProtocolError is returned if the server does not send a valid address
+// frame. Length is the invalid length received, or 0 if Err is set.
+type ProtocolError struct {
+	Length int
+	Err    error
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Err != nil {
+		return "protocol error: " + e.Err.Error()
+	}
+	return fmt.Sprintf("protocol error: invalid address length %d", e.Length)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// IsCertificateError reports whether err is caused by a failed verification
+// of the certificate presented by the server.
+func IsCertificateError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// Query connects to the servers one after another until one of them reports
+// an address, and disconnects. If no server does, the error returned is that
+// of the last server tried, unless an earlier one failed the verification of
+// its certificate.
+func (c *Client) Query() (ip net.IP, server string, err error) {
+	var queryErr error
+	c.idleTimeout = c.HeartbeatInterval/2 + c.HeartbeatInterval + time.Duration(c.MissedHeartbeatsAllowed)*c.HeartbeatInterval
+	endpoints := c.Endpoints
+	if c.Discovery != "" {
+		endpoints, err = c.discoverEndpoints()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, "", errors.New("no server specified")
+	}
+	for _, ep := range endpoints {
+		ip, err = c.queryEndpoint(ep)
+		if err == nil {
+			return ip, ep.Addr, nil
+		}
+		var protocolErr *ProtocolError
+		if errors.As(err, &protocolErr) {
+			return nil, ep.Addr, err
+		}
+		logger.Debug().Str("server", ep.Addr).Err(err).Msg("Failed to query IP address")
+		// A certificate error is kept over the connection failures of the
+		// servers tried after it, so that it decides the exit code of -once.
+		if queryErr == nil || !IsCertificateError(queryErr) {
+			server, queryErr = ep.Addr, err
+		}
+	}
+	return nil, server, queryErr
+}
+
+// queryEndpoint reads the address reported by the server at ep. Failures to
+// connect or to read from the connection, such as timeouts and resets, are
+// returned as they are, while a server that closes the connection early or
+// sends an invalid frame causes a ProtocolError.
+func (c *Client) queryEndpoint(ep Endpoint) (net.IP, error) {
+	conn, err := c.dial(ep)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip, err := c.readIPAddr(conn)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, &ProtocolError{Err: err}
+	} else if err != nil {
+		return nil, err
+	}
+	if !c.acceptsFamily(ip) {
+		return nil, &ProtocolError{Err: fmt.Errorf("received IP address %s of unexpected family", ip)}
+	}
+	return ip, nil
+}
+
+// Apply runs the update of ip reported by server once, as a session would,
+// and returns the error of the last attempt if it did not succeed.
+func (c *Client) Apply(server string, ip net.IP) error {
+	c.loadState()
+	c.seedPublished()
+	return c.update(context.Background(), server, ip)
+}
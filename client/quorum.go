@@ -0,0 +1,129 @@
+package client
+
+import (
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// quorum collects the addresses reported by the servers the client is
+// connected to, and only passes an address on once at least Quorum servers
+// agree on it. The agreement is evaluated again whenever a server leaves, so
+// that the address of the remaining servers is passed on if the agreed one
+// loses its quorum.
+type quorum struct {
+	client  *Client
+	mutex   sync.Mutex
+	reports map[string]net.IP
+	agreed  map[string]net.IP
+}
+
+func newQuorum(c *Client) *quorum {
+	return &quorum{
+		client:  c,
+		reports: make(map[string]net.IP),
+		agreed:  make(map[string]net.IP),
+	}
+}
+
+func (q *quorum) report(server string, ip net.IP) {
+	q.mutex.Lock()
+	q.reports[server] = ip
+	agreed, disagreed := 0, false
+	for _, reported := range q.reports {
+		if q.client.sameAddress(reported, ip) {
+			agreed++
+		} else if sameFamily(reported, ip) {
+			disagreed = true
+		}
+	}
+	if disagreed {
+		logger.Warning().Str("answers", q.answers(ip)).Msg("Servers disagree on the IP address")
+	}
+	if agreed >= q.client.Quorum {
+		q.agreed[Family(ip)] = ip
+	}
+	q.mutex.Unlock()
+	if agreed < q.client.Quorum {
+		logger.Info().Str("address", ip.String()).Int("agreed", agreed).Int("quorum", q.client.Quorum).Msg("Waiting for quorum")
+		return
+	}
+	q.client.stabilizer.observe(server, ip)
+}
+
+func (q *quorum) withdraw(server string) {
+	q.mutex.Lock()
+	ip, ok := q.reports[server]
+	if !ok {
+		q.mutex.Unlock()
+		return
+	}
+	delete(q.reports, server)
+	f := Family(ip)
+	current := q.agreed[f]
+	if current == nil || q.count(current) >= q.client.Quorum {
+		q.mutex.Unlock()
+		return
+	}
+	elected, electedServer := q.elect(f)
+	if elected == nil {
+		q.mutex.Unlock()
+		logger.Debug().Str("server", server).Str("address", current.String()).Int("quorum", q.client.Quorum).Msg("Address lost quorum, keeping it")
+		return
+	}
+	q.agreed[f] = elected
+	q.mutex.Unlock()
+	if q.client.sameAddress(elected, current) {
+		return
+	}
+	logger.Info().Str("server", server).Str("address", current.String()).Str("newAddress", elected.String()).Msg("Quorum changed after a server left")
+	q.client.stabilizer.observe(electedServer, elected)
+}
+
+// count returns the number of servers reporting ip.
+func (q *quorum) count(ip net.IP) int {
+	n := 0
+	for _, reported := range q.reports {
+		if q.client.sameAddress(reported, ip) {
+			n++
+		}
+	}
+	return n
+}
+
+// elect returns the address of family f reported by the most servers, and
+// one of the servers reporting it, or nil if no address reaches the quorum.
+// Ties are broken by the order of the server addresses.
+func (q *quorum) elect(f string) (net.IP, string) {
+	servers := make([]string, 0, len(q.reports))
+	for server := range q.reports {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	var elected net.IP
+	var electedServer string
+	most := 0
+	for _, server := range servers {
+		ip := q.reports[server]
+		if Family(ip) != f {
+			continue
+		}
+		if n := q.count(ip); n >= q.client.Quorum && n > most {
+			elected, electedServer, most = ip, server, n
+		}
+	}
+	return elected, electedServer
+}
+
+func (q *quorum) answers(ip net.IP) string {
+	var answers []string
+	for server, reported := range q.reports {
+		if sameFamily(reported, ip) {
+			answers = append(answers, server+"="+reported.String())
+		}
+	}
+	sort.Strings(answers)
+	return strings.Join(answers, ", ")
+}
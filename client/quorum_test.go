@@ -0,0 +1,102 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+// newTestClient returns a client whose updates are left pending instead of
+// being run.
+func newTestClient(quorum int) *Client {
+	c := &Client{Quorum: quorum}
+	c.updater = newUpdater(c)
+	c.stabilizer = newStabilizer(c)
+	c.quorum = newQuorum(c)
+	return c
+}
+
+// takeSubmitted returns the addresses submitted for update since the last call.
+func takeSubmitted(c *Client) []string {
+	c.updater.mutex.Lock()
+	defer c.updater.mutex.Unlock()
+	var submitted []string
+	for _, as := range []*addrState{c.updater.pending.IPv4, c.updater.pending.IPv6} {
+		if as != nil {
+			submitted = append(submitted, as.Address.String())
+		}
+	}
+	c.updater.pending = addrs{}
+	return submitted
+}
+
+func TestQuorum(t *testing.T) {
+	type step struct {
+		server    string
+		address   string // withdraws the server if empty
+		submitted []string
+	}
+	tests := []struct {
+		name   string
+		quorum int
+		steps  []step
+	}{
+		{"single server", 1, []step{
+			{"a", "192.0.2.1", []string{"192.0.2.1"}},
+			{"a", "", nil},
+			{"a", "192.0.2.2", []string{"192.0.2.2"}},
+		}},
+		{"quorum reached", 2, []step{
+			{"a", "192.0.2.1", nil},
+			{"b", "192.0.2.1", []string{"192.0.2.1"}},
+			{"c", "192.0.2.1", []string{"192.0.2.1"}},
+		}},
+		{"agreed address loses quorum to another", 2, []step{
+			{"a", "192.0.2.1", nil},
+			{"b", "192.0.2.1", []string{"192.0.2.1"}},
+			{"c", "192.0.2.2", nil},
+			{"d", "192.0.2.2", []string{"192.0.2.2"}},
+			{"d", "", []string{"192.0.2.1"}},
+		}},
+		{"agreed address loses quorum to none", 2, []step{
+			{"a", "192.0.2.1", nil},
+			{"b", "192.0.2.1", []string{"192.0.2.1"}},
+			{"a", "", nil},
+			{"b", "", nil},
+		}},
+		{"remaining server takes over", 1, []step{
+			{"a", "192.0.2.1", []string{"192.0.2.1"}},
+			{"b", "192.0.2.2", []string{"192.0.2.2"}},
+			{"b", "", []string{"192.0.2.1"}},
+		}},
+		{"other server leaves", 1, []step{
+			{"a", "192.0.2.1", []string{"192.0.2.1"}},
+			{"b", "192.0.2.2", []string{"192.0.2.2"}},
+			{"a", "", nil},
+		}},
+		{"families are independent", 1, []step{
+			{"a", "192.0.2.1", []string{"192.0.2.1"}},
+			{"b", "2001:db8::1", []string{"2001:db8::1"}},
+			{"b", "", nil},
+		}},
+		{"unknown server leaves", 1, []step{
+			{"a", "192.0.2.1", []string{"192.0.2.1"}},
+			{"b", "", nil},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(test.quorum)
+			for i, s := range test.steps {
+				if s.address == "" {
+					c.quorum.withdraw(s.server)
+				} else {
+					c.quorum.report(s.server, net.ParseIP(s.address))
+				}
+				got := takeSubmitted(c)
+				if len(got) != len(s.submitted) || len(got) > 0 && got[0] != s.submitted[0] {
+					t.Errorf("step %d: submitted %q, want %q", i, got, s.submitted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+package client
+
+// The syscall package does not define SYS_SETNS on this architecture.
+const sysSetns = 346
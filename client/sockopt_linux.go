@@ -0,0 +1,31 @@
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+const sockoptsSupported = true
+
+func (c *Client) control(_, _ string, rc syscall.RawConn) error {
+	var err error
+	controlErr := rc.Control(func(fd uintptr) {
+		if c.Interface != "" {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, c.Interface)
+			if err != nil {
+				err = os.NewSyscallError("setsockopt SO_BINDTODEVICE", err)
+				return
+			}
+		}
+		if c.Mark != 0 {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, c.Mark)
+			if err != nil {
+				err = os.NewSyscallError("setsockopt SO_MARK", err)
+			}
+		}
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
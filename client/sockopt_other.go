@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import "syscall"
+
+const sockoptsSupported = false
+
+func (c *Client) control(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"sync"
+	"time"
+)
+
+type candidate struct {
+	address  net.IP
+	server   string
+	since    time.Time
+	sessions int
+	timer    *time.Timer
+}
+
+// stabilizer holds back a new address until it has been observed for
+// StableDuration without another address in between, or on StableSessions
+// consecutive sessions, so that short-lived address flaps do not cause updates.
+// The sessions are counted across all servers, so a session with each of
+// several servers counts once each. The first address of a family is passed
+// on at once, since there is no published address to keep in the meantime.
+type stabilizer struct {
+	client     *Client
+	mutex      sync.Mutex
+	accepted   map[string]net.IP
+	candidates map[string]*candidate
+}
+
+func newStabilizer(c *Client) *stabilizer {
+	s := &stabilizer{
+		client:     c,
+		accepted:   make(map[string]net.IP),
+		candidates: make(map[string]*candidate),
+	}
+	for _, as := range c.state.published() {
+		s.accepted[Family(as.Address)] = as.Address
+	}
+	return s
+}
+
+func (s *stabilizer) enabled() bool {
+	return s.client.StableDuration > 0 || s.client.StableSessions > 1
+}
+
+func (s *stabilizer) observe(server string, ip net.IP) {
+	if !s.enabled() {
+		s.client.updater.submit(server, ip)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f := Family(ip)
+	if s.accepted[f] == nil {
+		logger.Debug().Str("address", ip.String()).Msg("No address published before, skipping stabilization")
+		s.accepted[f] = ip
+		s.client.updater.submit(server, ip)
+		return
+	}
+	if s.client.sameAddress(ip, s.accepted[f]) {
+		if cand := s.candidates[f]; cand != nil {
+			logger.Info().Str("address", ip.String()).Str("pendingAddress", cand.address.String()).Msg("Address changed back, discarding pending address")
+			s.discard(f)
+		}
+		s.client.updater.submit(server, ip)
+		return
+	}
+	cand := s.candidates[f]
+	if cand != nil && s.client.sameAddress(cand.address, ip) {
+		cand.sessions++
+		cand.server = server
+	} else {
+		s.discard(f)
+		cand = &candidate{address: ip, server: server, since: time.Now(), sessions: 1}
+		if s.client.StableDuration > 0 {
+			cand.timer = time.AfterFunc(s.client.StableDuration, func() {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+				if s.candidates[f] == cand {
+					s.accept(f, cand)
+				}
+			})
+		}
+		s.candidates[f] = cand
+	}
+	if s.client.StableSessions > 1 && cand.sessions >= s.client.StableSessions {
+		s.accept(f, cand)
+		return
+	}
+	logger.Info().Str("pendingAddress", ip.String()).Int("sessions", cand.sessions).Str("observed", time.Since(cand.since).Round(time.Millisecond).String()).Msg("Address change suppressed until stable")
+}
+
+func (s *stabilizer) accept(f string, cand *candidate) {
+	s.discard(f)
+	s.accepted[f] = cand.address
+	logger.Debug().Str("address", cand.address.String()).Int("sessions", cand.sessions).Str("observed", time.Since(cand.since).Round(time.Millisecond).String()).Msg("Address is stable")
+	s.client.updater.submit(cand.server, cand.address)
+}
+
+func (s *stabilizer) discard(f string) {
+	if cand := s.candidates[f]; cand != nil && cand.timer != nil {
+		cand.timer.Stop()
+	}
+	delete(s.candidates, f)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStabilizer(t *testing.T) {
+	type step struct {
+		server    string
+		address   string        // only waits if empty
+		wait      time.Duration // waited after observing the address
+		submitted []string
+	}
+	tests := []struct {
+		name           string
+		stableDuration time.Duration
+		stableSessions int
+		steps          []step
+	}{
+		{"disabled", 0, 1, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, []string{"192.0.2.2"}},
+		}},
+		{"first address is passed on at once", 100 * time.Millisecond, 0, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+		}},
+		{"timer accepts stable address", 100 * time.Millisecond, 0, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"", "", 200 * time.Millisecond, []string{"192.0.2.2"}},
+		}},
+		{"another address restarts timer", 100 * time.Millisecond, 0, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 60 * time.Millisecond, nil},
+			{"a", "192.0.2.3", 60 * time.Millisecond, nil},
+			{"", "", 100 * time.Millisecond, []string{"192.0.2.3"}},
+		}},
+		{"candidate discarded when address changes back", 100 * time.Millisecond, 0, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"", "", 200 * time.Millisecond, nil},
+		}},
+		{"sessions accept stable address", 0, 3, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"b", "192.0.2.2", 0, nil},
+			{"a", "192.0.2.2", 0, []string{"192.0.2.2"}},
+			{"a", "192.0.2.2", 0, []string{"192.0.2.2"}},
+		}},
+		{"another address restarts count", 0, 2, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"a", "192.0.2.3", 0, nil},
+			{"a", "192.0.2.3", 0, []string{"192.0.2.3"}},
+		}},
+		{"address changing back resets count", 0, 2, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"a", "192.0.2.2", 0, []string{"192.0.2.2"}},
+		}},
+		{"families are independent", 0, 2, []step{
+			{"a", "192.0.2.1", 0, []string{"192.0.2.1"}},
+			{"a", "2001:db8::1", 0, []string{"2001:db8::1"}},
+			{"a", "192.0.2.2", 0, nil},
+			{"a", "2001:db8::2", 0, nil},
+			{"a", "192.0.2.2", 0, []string{"192.0.2.2"}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(1)
+			c.StableDuration, c.StableSessions = test.stableDuration, test.stableSessions
+			for i, s := range test.steps {
+				if s.address != "" {
+					c.stabilizer.observe(s.server, net.ParseIP(s.address))
+				}
+				time.Sleep(s.wait)
+				got := takeSubmitted(c)
+				if len(got) != len(s.submitted) || len(got) > 0 && got[0] != s.submitted[0] {
+					t.Errorf("step %d: submitted %q, want %q", i, got, s.submitted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/zhouchenh/active-ddns/atomicfile"
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"os"
+	"time"
+)
+
+// addrState is an address reported by a server.
+type addrState struct {
+	Address net.IP    `json:"address"`
+	Server  string    `json:"server,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// addrs holds an address of each family.
+type addrs struct {
+	IPv4 *addrState
+	IPv6 *addrState
+}
+
+func (a *addrs) get(ip net.IP) *addrState {
+	if ip.To4() != nil {
+		return a.IPv4
+	}
+	return a.IPv6
+}
+
+func (a *addrs) set(ip net.IP, as *addrState) {
+	if ip.To4() != nil {
+		a.IPv4 = as
+	} else {
+		a.IPv6 = as
+	}
+}
+
+// familyState is the state of the updates of an address family. Published is
+// the address of the last successful update, which is the old address of the
+// next one. Attempted is the address of the last update, and Succeeded is
+// whether it succeeded. If it did not, the record may have been changed before
+// the update failed or was interrupted, so the next update is run even if its
+// address is the published one, including after a restart.
+type familyState struct {
+	Published *addrState `json:"published,omitempty"`
+	Attempted *addrState `json:"attempted,omitempty"`
+	Succeeded bool       `json:"succeeded"`
+}
+
+type state struct {
+	IPv4 *familyState `json:"ipv4,omitempty"`
+	IPv6 *familyState `json:"ipv6,omitempty"`
+}
+
+// family returns the state of the family of ip, which is created if there is
+// none yet.
+func (s *state) family(ip net.IP) *familyState {
+	fs := &s.IPv6
+	if ip.To4() != nil {
+		fs = &s.IPv4
+	}
+	if *fs == nil {
+		*fs = &familyState{}
+	}
+	return *fs
+}
+
+// published returns the published addresses.
+func (s *state) published() []*addrState {
+	var published []*addrState
+	for _, fs := range []*familyState{s.IPv4, s.IPv6} {
+		if fs != nil && fs.Published != nil {
+			published = append(published, fs.Published)
+		}
+	}
+	return published
+}
+
+func (c *Client) loadState() {
+	if c.StateFile == "" {
+		return
+	}
+	data, err := os.ReadFile(c.StateFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warning().Str("file", c.StateFile).Err(err).Msg("Failed to read state file")
+		}
+		return
+	}
+	var s state
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		logger.Warning().Str("file", c.StateFile).Err(err).Msg("Failed to parse state file")
+		return
+	}
+	c.state = s
+	for _, fs := range []*familyState{s.IPv4, s.IPv6} {
+		if fs == nil {
+			continue
+		}
+		event := logger.Debug().Bool("succeeded", fs.Succeeded)
+		if fs.Published != nil {
+			event = event.Str("published", fs.Published.Address.String()).Time("time", fs.Published.Time)
+		}
+		if fs.Attempted != nil {
+			event = event.Str("attempted", fs.Attempted.Address.String())
+		}
+		event.Msg("Loaded state")
+	}
+}
+
+// seedPublished records the addresses of Published, which are known to be
+// published already, in the state, so that they are not updated again and are
+// the old addresses of the next updates.
+func (c *Client) seedPublished() {
+	if len(c.Published) == 0 {
+		return
+	}
+	for _, ip := range c.Published {
+		fs := c.state.family(ip)
+		if fs.Published != nil && fs.Published.Address.Equal(ip) && fs.Succeeded {
+			continue
+		}
+		logger.Debug().Str("address", ip.String()).Msg("Seeded published address")
+		// The record is known to hold the address, whatever the last attempt
+		// did, so it is regarded as successful.
+		fs.Published = &addrState{Address: ip, Time: time.Now()}
+		fs.Attempted, fs.Succeeded = fs.Published, true
+	}
+	c.saveState()
+}
+
+func (c *Client) saveState() {
+	if c.StateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(&c.state, "", "  ")
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode state")
+		return
+	}
+	err = atomicfile.WriteFile(c.StateFile, append(data, '\n'), 0600)
+	if err != nil {
+		logger.Error().Str("file", c.StateFile).Err(err).Msg("Failed to write state file")
+	}
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"sync"
+	"time"
+)
+
+// updater runs the updates of a client one at a time. Only the latest pending
+// address of each family is kept, and an in-flight update is cancelled once a
+// different address of the same family is submitted.
+type updater struct {
+	client   *Client
+	mutex    sync.Mutex
+	pending  addrs
+	inFlight net.IP
+	cancel   context.CancelFunc
+	wake     chan struct{}
+}
+
+func newUpdater(c *Client) *updater {
+	return &updater{
+		client: c,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (u *updater) submit(server string, ip net.IP) {
+	u.mutex.Lock()
+	if u.inFlight != nil && sameFamily(u.inFlight, ip) {
+		if u.client.sameAddress(u.inFlight, ip) {
+			u.pending.set(ip, nil)
+			u.mutex.Unlock()
+			return
+		}
+		logger.Info().Str("address", u.inFlight.String()).Str("newAddress", ip.String()).Msg("Cancelling superseded update")
+		u.cancel()
+		u.inFlight = nil
+	}
+	if as := u.pending.get(ip); as != nil && !u.client.sameAddress(as.Address, ip) {
+		logger.Debug().Str("address", as.Address.String()).Str("newAddress", ip.String()).Msg("Dropped stale pending update")
+	}
+	u.pending.set(ip, &addrState{Address: ip, Server: server, Time: time.Now()})
+	u.mutex.Unlock()
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (u *updater) run() {
+	for range u.wake {
+		for {
+			as, ctx, cancel := u.next()
+			if as == nil {
+				break
+			}
+			_ = u.client.update(ctx, as.Server, as.Address)
+			u.mutex.Lock()
+			cancel()
+			u.inFlight, u.cancel = nil, nil
+			u.mutex.Unlock()
+		}
+	}
+}
+
+func (u *updater) next() (*addrState, context.Context, context.CancelFunc) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for _, as := range []*addrState{u.pending.IPv4, u.pending.IPv6} {
+		if as == nil {
+			continue
+		}
+		u.pending.set(as.Address, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		u.inFlight, u.cancel = as.Address, cancel
+		return as, ctx, cancel
+	}
+	return nil, nil, nil
+}
+
+func (c *Client) update(ctx context.Context, server string, ip net.IP) error {
+	fs := c.state.family(ip)
+	c.report(server, ip, fs.Published)
+	var oldIP net.IP
+	if fs.Published != nil {
+		if c.sameAddress(ip, fs.Published.Address) {
+			// The last attempt may have changed the record before it failed
+			// or was interrupted, so the published address is applied again.
+			if fs.Attempted == nil || fs.Succeeded {
+				return nil
+			}
+			logger.Info().Str("address", ip.String()).Str("attempted", fs.Attempted.Address.String()).Msg("Applying published address again after an unsuccessful update")
+		}
+		oldIP = fs.Published.Address
+	}
+	// Record the attempt before running the update, so that an interrupted
+	// update is retried after a restart.
+	fs.Attempted, fs.Succeeded = &addrState{Address: ip, Server: server, Time: time.Now()}, false
+	c.saveState()
+	c.RetryInterval.Minimize()
+	pending := c.updates(ip, oldIP, server)
+	for attempt := 1; ; attempt++ {
+		var failed []*Update
+		var err error
+		for _, u := range pending {
+			if updateErr := c.OnIPAddrUpdate(ctx, u); updateErr != nil {
+				failed, err = append(failed, u), updateErr
+			}
+			if ctx.Err() != nil {
+				logger.Info().Str("address", ip.String()).Msg("Update superseded")
+				return ctx.Err()
+			}
+		}
+		pending = failed
+		if err == nil {
+			fs.Published, fs.Succeeded = &addrState{Address: ip, Server: server, Time: time.Now()}, true
+			c.saveState()
+			if attempt > 1 {
+				logger.Info().Str("address", ip.String()).Int("attempts", attempt).Msg("Update succeeded after retrying")
+			}
+			return nil
+		}
+		if attempt > c.MaxRetries {
+			logger.Error().Str("address", ip.String()).Int("attempts", attempt).Err(err).Msg("Update failed repeatedly, giving up")
+			for _, u := range pending {
+				c.emit(&Event{Type: EventUpdateFailed, Update: *u, Err: err})
+			}
+			return err
+		}
+		ri := c.RetryInterval.Duration()
+		c.RetryInterval.Double()
+		logger.Info().Str("address", ip.String()).Int("attempt", attempt).Str("duration", ri.String()).Msg("Waiting for retrying update")
+		select {
+		case <-ctx.Done():
+			logger.Info().Str("address", ip.String()).Msg("Update superseded")
+			return ctx.Err()
+		case <-time.After(ri):
+		}
+	}
+}
+
+// report calls OnIPAddrReport with ip reported by server, whether or not it
+// is then updated.
+func (c *Client) report(server string, ip net.IP, published *addrState) {
+	if c.OnIPAddrReport == nil {
+		return
+	}
+	u := &Update{Family: Family(ip), IPAddr: ip, Server: server, Time: time.Now()}
+	if published != nil && !c.sameAddress(ip, published.Address) {
+		u.OldIPAddr = published.Address
+	}
+	c.OnIPAddrReport(u)
+}
+
+func sameFamily(a, b net.IP) bool {
+	return Family(a) == Family(b)
+}
+
+// Family returns the family of ip, "ipv4" or "ipv6", as used in updates.
+func Family(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// newUpdateID returns a random identifier for correlating the logs of an
+// update.
+func newUpdateID() string {
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
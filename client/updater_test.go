@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/zhouchenh/active-ddns/doublable"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestUpdateOldAddress checks that the old address of an update is the last
+// published address, which is neither changed by failed updates nor lost on a
+// restart, that the published address is applied again after a failed
+// update, and that every address is reported, even if its update is skipped.
+func TestUpdateOldAddress(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	steps := []struct {
+		address string
+		fail    bool
+		restart bool
+		// oldAddress is the old address of the update, or "skipped" if the
+		// update is not run.
+		oldAddress string
+	}{
+		{"192.0.2.1", false, false, ""},
+		{"192.0.2.2", true, false, "192.0.2.1"},
+		{"192.0.2.2", true, true, "192.0.2.1"},
+		{"192.0.2.3", false, false, "192.0.2.1"},
+		{"192.0.2.3", false, false, "skipped"},
+		{"192.0.2.3", false, true, "skipped"},
+		{"192.0.2.4", true, true, "192.0.2.3"},
+		{"192.0.2.3", false, true, "192.0.2.3"},
+		{"192.0.2.3", false, false, "skipped"},
+		{"2001:db8::1", false, false, ""},
+		{"192.0.2.5", false, true, "192.0.2.3"},
+	}
+	var c *Client
+	for i, step := range steps {
+		if c == nil || step.restart {
+			c = &Client{
+				RetryInterval: &doublable.Duration{Min: time.Millisecond, Max: time.Millisecond},
+				StateFile:     stateFile,
+			}
+			c.loadState()
+		}
+		oldAddress := "skipped"
+		fail := step.fail
+		var reported net.IP
+		c.OnIPAddrReport = func(u *Update) {
+			reported = u.IPAddr
+		}
+		c.OnIPAddrUpdate = func(_ context.Context, u *Update) error {
+			oldAddress = ""
+			if u.OldIPAddr != nil {
+				oldAddress = u.OldIPAddr.String()
+			}
+			if fail {
+				return errors.New("update failed")
+			}
+			return nil
+		}
+		err := c.update(context.Background(), "server", net.ParseIP(step.address))
+		if (err != nil) != step.fail {
+			t.Errorf("step %d: update() error = %v, want error %t", i, err, step.fail)
+		}
+		if oldAddress != step.oldAddress {
+			t.Errorf("step %d: old address = %q, want %q", i, oldAddress, step.oldAddress)
+		}
+		if reported.String() != step.address {
+			t.Errorf("step %d: reported address = %v, want %s", i, reported, step.address)
+		}
+	}
+}
+
+func TestSeedPublished(t *testing.T) {
+	c := &Client{
+		RetryInterval: &doublable.Duration{Min: time.Millisecond, Max: time.Millisecond},
+		Published:     []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+	}
+	c.seedPublished()
+	var oldAddresses []string
+	c.OnIPAddrUpdate = func(_ context.Context, u *Update) error {
+		oldAddresses = append(oldAddresses, u.OldIPAddr.String())
+		return nil
+	}
+	for _, address := range []string{"192.0.2.1", "2001:db8::1", "192.0.2.2"} {
+		err := c.update(context.Background(), "server", net.ParseIP(address))
+		if err != nil {
+			t.Fatalf("update(%s) error = %v", address, err)
+		}
+	}
+	if len(oldAddresses) != 1 || oldAddresses[0] != "192.0.2.1" {
+		t.Errorf("old addresses of the updates run = %q, want only 192.0.2.1", oldAddresses)
+	}
+}
@@ -0,0 +1,95 @@
+package dnscheck
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const lookupTimeout = 5 * time.Second
+
+type Checker struct {
+	Hostname string
+	Resolver string
+	Timeout  time.Duration
+	Interval time.Duration
+	once     sync.Once
+	resolver *net.Resolver
+}
+
+type Result struct {
+	Propagated bool
+	Elapsed    time.Duration
+	Addresses  []net.IP
+}
+
+func (c *Checker) Lookup(ctx context.Context, ip net.IP) ([]net.IP, error) {
+	network := "ip6"
+	if ip.To4() != nil {
+		network = "ip4"
+	}
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	return c.netResolver().LookupIP(ctx, network, c.Hostname)
+}
+
+func (c *Checker) Matches(ctx context.Context, ip net.IP) (matches bool, addrs []net.IP, err error) {
+	addrs, err = c.Lookup(ctx, ip)
+	if err != nil {
+		return false, nil, err
+	}
+	for _, addr := range addrs {
+		if addr.Equal(ip) {
+			return true, addrs, nil
+		}
+	}
+	return false, addrs, nil
+}
+
+func (c *Checker) WaitForPropagation(ctx context.Context, ip net.IP) (result Result) {
+	start := time.Now()
+	deadline := start.Add(c.Timeout)
+	for {
+		matches, addrs, err := c.Matches(ctx, ip)
+		result.Elapsed = time.Since(start)
+		if err == nil {
+			result.Addresses = addrs
+		}
+		if matches {
+			result.Propagated = true
+			return
+		}
+		if !time.Now().Add(c.Interval).Before(deadline) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// netResolver returns the resolver of the checker, which is created on first
+// use. It is safe for concurrent use by the updates of both families.
+func (c *Checker) netResolver() *net.Resolver {
+	c.once.Do(func() {
+		if c.Resolver == "" {
+			c.resolver = net.DefaultResolver
+			return
+		}
+		address := c.Resolver
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "53")
+		}
+		dialer := &net.Dialer{}
+		c.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+		}
+	})
+	return c.resolver
+}
@@ -0,0 +1,65 @@
+package doublable
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+		ops      string
+		want     time.Duration
+	}{
+		{"zero value is the minimum", time.Second, time.Minute, "", time.Second},
+		{"minimize", time.Second, time.Minute, "m", time.Second},
+		{"maximize", time.Second, time.Minute, "M", time.Minute},
+		{"double from zero", time.Second, time.Minute, "d", time.Second},
+		{"double", time.Second, time.Minute, "mdd", 4 * time.Second},
+		{"double up to the maximum", time.Second, 5 * time.Second, "mddd", 5 * time.Second},
+		{"double beyond the maximum", time.Second, 5 * time.Second, "mdddddd", 5 * time.Second},
+		{"halve", time.Second, time.Minute, "Mh", 30 * time.Second},
+		{"halve down to the minimum", time.Second, 3 * time.Second, "Mhh", time.Second},
+		{"double after halving", 2 * time.Second, 10 * time.Second, "Mhd", 10 * time.Second},
+		{"minimize after doubling", time.Second, time.Minute, "mdddm", time.Second},
+		{"zero minimum", 0, time.Second, "d", 0},
+		{"equal bounds", time.Second, time.Second, "mdh", time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := Duration{Min: test.min, Max: test.max}
+			for _, op := range test.ops {
+				switch op {
+				case 'd':
+					d.Double()
+				case 'h':
+					d.Halve()
+				case 'm':
+					d.Minimize()
+				case 'M':
+					d.Maximize()
+				}
+			}
+			if got := d.Duration(); got != test.want {
+				t.Errorf("Duration() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// TestDurationCopy checks that a copy, such as the redial interval of each
+// session, doubles independently of the original.
+func TestDurationCopy(t *testing.T) {
+	original := Duration{Min: time.Second, Max: time.Minute}
+	original.Minimize()
+	c := original
+	c.Double()
+	c.Double()
+	if got := original.Duration(); got != time.Second {
+		t.Errorf("original Duration() = %s, want %s", got, time.Second)
+	}
+	if got := c.Duration(); got != 4*time.Second {
+		t.Errorf("copy Duration() = %s, want %s", got, 4*time.Second)
+	}
+}
@@ -4,12 +4,52 @@ import "flag"
 
 var (
 	serverListenAddr  = flag.String("s", "", "Run as a server and listen at the specific address")
-	clientConnectAddr = flag.String("c", "", "Run as a client and connect to the specific address")
+	clientConnectAddr = flag.String("c", "", "Run as a client and connect to the specific address, or a comma-separated list of addresses")
+	once              = flag.Bool("once", false, "Query the IP address once, print it, run the update if -script, -starlark or -output is specified, and exit")
+	srvDomain         = flag.String("srv", "", "Run as a client and connect to the servers discovered from the _active-ddns._tcp SRV records of the specific domain, looked up from inside the network namespace specified with -netns")
+	ipv4Only          = flag.Bool("4", false, "Connect to the server over IPv4 only and update the IPv4 address only")
+	ipv6Only          = flag.Bool("6", false, "Connect to the server over IPv6 only and update the IPv6 address only")
+	happyEyeballs     = flag.Bool("he", false, "Connect to the server with Happy Eyeballs (RFC 8305) over both IPv6 and IPv4")
+	localAddr         = flag.String("bind", "", "Specify the local IP address to connect to the server from")
+	bindInterface     = flag.String("iface", "", "Specify the network interface to connect to the server through (Linux only)")
+	fwMark            = flag.Int("fwmark", 0, "Specify the firewall mark set on connections to the server for policy routing (Linux only)")
+	netnsPath         = flag.String("netns", "", "Specify the path to the network namespace to connect to the server from, such as /run/netns/wan1 (Linux only)")
+	watchNetwork      = flag.Bool("watch", false, "Reconnect at once when the addresses or routes of the network interfaces change (Linux only)")
+	watchInterfaces   = flag.String("watchif", "", "Specify a comma-separated list of network interfaces watched by -watch, or watch the interface specified with -iface, or the interfaces carrying a default route, if empty")
 	script            = flag.String("script", "", "Specify the script to be executed when the IP address is updated")
+	starlarkFile      = flag.String("starlark", "", "Specify the path to the Starlark script whose on_update(event) function is called when the IP address is updated, instead of a script run by the shell; it runs in-process, so -scriptuser, -scriptgroup, -scriptenv, -scriptumask, -scriptcpu and -scriptnofile do not apply to it")
+	probeScript       = flag.String("probe", "", "Specify the script which prints the currently published IP addresses, separated by whitespace, executed on startup to seed the published address and before each update to skip the update if the address is already published")
+	outputPath        = flag.String("output", "", "Specify the path to the file where the latest IP address of each family is written whenever a server reports it, even if it is already published")
+	outputFormat      = flag.String("outputformat", "text", "Specify the format of the output file, which is one address per line or a JSON object of the address of each family, and of the IP address printed with -once { text | json }")
+	outputPerm        = flag.String("outputperm", "0644", "Specify the permissions of the output file in octal")
 	keyword           = flag.String("keyword", "{}", "Specify the keyword in the script to be replaced by the updated IP address")
-	shellArgs         = flag.String("shell", "", "Specify the shell and arguments which is used to run the DDNS script")
-	certFilePath      = flag.String("cert", "", "Specify the path to the certificate file")
-	keyFilePath       = flag.String("key", "", "Specify the path to the private key file")
+	prefixLength      = flag.Int("prefixlen", 0, "Specify the length of the IPv6 prefix, so that an IPv6 address is regarded as changed only if its prefix changes")
+	hostList          = flag.String("hosts", "", "Specify a comma-separated list of hostname=interface-identifier entries of LAN hosts whose IPv6 addresses are derived from the prefix")
+	hostKeyword       = flag.String("hostkeyword", "{host}", "Specify the keyword in the script to be replaced by the hostname of the LAN host")
+	useTemplate       = flag.Bool("template", false, "Render the scripts as Go text/templates with the fields .Event, .IP, .OldIP, .Family, .Host, .Server, .Port, .Client, .Time, .Duration and .Error and the functions reverse and prefix, instead of replacing the keywords")
+	stdinJSON         = flag.Bool("stdinjson", false, "Write the update as a JSON document to the standard input of the script")
+	onConnect         = flag.String("onconnect", "", "Specify the script to be executed when a session with a server is established, or with a client in server mode")
+	onDisconnect      = flag.String("ondisconnect", "", "Specify the script to be executed when a session with a server is lost, or with a client in server mode")
+	onOutage          = flag.String("onoutage", "", "Specify the script to be executed when a server has been unreachable, or has stopped sending heartbeats, for the time specified with -outagetime")
+	onRecover         = flag.String("onrecover", "", "Specify the script to be executed when a server is reachable again after an outage")
+	onUpdateFail      = flag.String("onupdatefail", "", "Specify the script to be executed when an update fails after all retries")
+	outageTime        = flag.Int("outagetime", 60000, "Specify the time in milliseconds a server should be unreachable before it is regarded as an outage")
+	scriptTimeout     = flag.Int("scripttimeout", 0, "Specify the time in milliseconds the script, or on_update of the Starlark script, is allowed to run before it is terminated, or 0 to disable")
+	scriptLimit       = flag.Int("scriptlimit", 65536, "Specify the maximal number of bytes of the output of a run of the script which are logged, or 0 for no limit")
+	scriptTail        = flag.Int("scripttail", 10, "Specify the number of last lines of the output of the script included in the failure warning")
+	scriptGrace       = flag.Int("scriptgrace", 5000, "Specify the time in milliseconds between asking the script to terminate and killing it")
+	scriptUser        = flag.String("scriptuser", "", "Specify the name or ID of the user the scripts run as")
+	scriptGroup       = flag.String("scriptgroup", "", "Specify the name or ID of the group the scripts run as, or use the primary group of the user specified with -scriptuser if empty")
+	scriptEnvNames    = flag.String("scriptenv", "", "Specify a comma-separated list of the environment variables inherited by the scripts, or inherit all of them if empty")
+	scriptDir         = flag.String("scriptdir", "", "Specify the working directory of the scripts, and the only directory whose files the Starlark script may read with read_file")
+	scriptUmask       = flag.String("scriptumask", "", "Specify the umask of the scripts in octal, or inherit it if empty")
+	scriptCPU         = flag.Int("scriptcpu", 0, "Specify the CPU time in milliseconds the scripts may use, rounded up to seconds, or 0 for no limit")
+	scriptNoFile      = flag.Int("scriptnofile", 0, "Specify the number of files the scripts may open, or 0 for no limit")
+	shellArgs         = flag.String("shell", "", "Specify the shell and arguments which is used to run the DDNS script, parsed as shell words, or separated by spaces on Windows")
+	execScript        = flag.Bool("exec", false, "Execute the script directly as a program and arguments parsed as shell words, without a shell, replacing the keywords or rendering the template in each argument")
+	certFilePath      = flag.String("cert", "", "Specify the path to the certificate file, which is presented to the server as a client certificate in client mode")
+	keyFilePath       = flag.String("key", "", "Specify the path to the private key file of the certificate")
+	clientCAFile      = flag.String("clientca", "", "Specify the path to the CA certificates which client certificates are verified against, and require clients to present a certificate identifying them to the hooks")
 	noTLS             = flag.Bool("notls", false, "Do not use TLS")
 	insecureTLS       = flag.Bool("insecuretls", false, "Allow insecure TLS")
 	tlsServerName     = flag.String("servername", "", "Specify the server name in the certificate presented by the server")
@@ -17,6 +57,20 @@ var (
 	mhbValue          = flag.Int("mhb", 3, "Specify the number of missed heartbeats allowed before disconnection")
 	minRI             = flag.Int("minri", 1000, "Specify the minimal interval between reconnections in milliseconds")
 	maxRI             = flag.Int("maxri", 15000, "Specify the maximal interval between reconnections in milliseconds")
+	failoverMode      = flag.String("failover", "", "Specify how to select a server from the list to connect to one at a time { priority | roundrobin }, or connect to all servers if empty")
+	failAfter         = flag.Int("failafter", 3, "Specify the number of consecutive connection failures before failing over to the next server")
+	preferInterval    = flag.Int("preferinterval", 60000, "Specify the interval in milliseconds between attempts to return to a more preferred server, or 0 to disable")
+	quorumValue       = flag.Int("quorum", 1, "Specify the number of servers which should report the same IP address before it is updated")
+	minRTI            = flag.Int("minrti", 5000, "Specify the minimal interval between retries of a failed update in milliseconds")
+	maxRTI            = flag.Int("maxrti", 300000, "Specify the maximal interval between retries of a failed update in milliseconds")
+	maxRetries        = flag.Int("retries", 5, "Specify the maximal number of retries of a failed update")
+	stableTime        = flag.Int("stabletime", 0, "Specify the time in milliseconds a new IP address should be observed before it replaces the published one, or 0 to disable")
+	stableSessions    = flag.Int("stablesessions", 0, "Specify the number of consecutive sessions, counted across all servers, a new IP address should be observed on before it is updated, or 0 to disable")
+	stateFilePath     = flag.String("state", "", "Specify the path to the file where the client state is persisted across restarts")
+	checkHostname     = flag.String("check", "", "Specify the hostname whose DNS record is checked before and after the update")
+	resolverAddr      = flag.String("resolver", "", "Specify the DNS resolver address used by -check, or use the system resolver if empty")
+	verifyTimeout     = flag.Int("verify", 0, "Specify the timeout in milliseconds for waiting for the updated DNS record to propagate, whose result is also written to the -output JSON document, or 0 to disable")
+	verifyInterval    = flag.Int("verifyinterval", 2000, "Specify the interval between DNS record propagation checks in milliseconds")
 	logLevelStr       = flag.String("log", "info", "Specify the log level { debug | info | warning | error | off }")
 	logTime           = flag.Bool("logtime", false, "Output logs with timestamps")
 	version           = flag.Bool("version", false, "Print version information and exit")
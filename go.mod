@@ -2,4 +2,7 @@ module github.com/zhouchenh/active-ddns
 
 go 1.16
 
-require github.com/rs/zerolog v1.23.0
+require (
+	github.com/rs/zerolog v1.23.0
+	go.starlark.net v0.0.0-20230525235612-a134d8f9ddca
+)
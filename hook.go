@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/zhouchenh/active-ddns/client"
+	"github.com/zhouchenh/active-ddns/logger"
+	"github.com/zhouchenh/active-ddns/server"
+	"github.com/zhouchenh/active-ddns/shell"
+	"net"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// hook is a script run with the details of an update or an event. All hooks
+// are run with the same -shell, -exec, -template and keyword settings.
+type hook struct {
+	name         string
+	script       string
+	args         []string
+	template     *template.Template
+	argTemplates []*template.Template
+}
+
+// newHook parses the script of a hook, or each argument of it with -exec, and
+// checks the templates against a sample update.
+func newHook(name, script string) (*hook, error) {
+	h := &hook{name: name, script: script}
+	if *execScript {
+		args, err := shell.Split(script)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, errors.New("no program specified")
+		}
+		h.args = args
+	}
+	if !*useTemplate {
+		return h, nil
+	}
+	sample := newTemplateData(sampleUpdate())
+	if !*execScript {
+		t, err := parseTemplate(name, script)
+		if err == nil {
+			_, err = execTemplate(t, sample)
+		}
+		h.template = t
+		return h, err
+	}
+	for i, arg := range h.args {
+		t, err := parseTemplate(fmt.Sprintf("%s[%d]", name, i), arg)
+		if err == nil {
+			_, err = execTemplate(t, sample)
+		}
+		if err != nil {
+			return nil, err
+		}
+		h.argTemplates = append(h.argTemplates, t)
+	}
+	return h, nil
+}
+
+// render returns the script, or the command with -exec, either rendered from
+// the template with -template, or with the keywords replaced.
+func (h *hook) render(data *templateData) (shell.Runner, error) {
+	if !*execScript {
+		scriptString, err := renderArg(h.script, h.template, data)
+		return shell.Script(scriptString), err
+	}
+	command := make(shell.Command, len(h.args))
+	for i, arg := range h.args {
+		var t *template.Template
+		if h.argTemplates != nil {
+			t = h.argTemplates[i]
+		}
+		var err error
+		command[i], err = renderArg(arg, t, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return command, nil
+}
+
+func renderArg(s string, t *template.Template, data *templateData) (string, error) {
+	if t != nil {
+		return execTemplate(t, data)
+	}
+	s = strings.ReplaceAll(s, *keyword, data.IP)
+	if *hostList != "" {
+		s = strings.ReplaceAll(s, *hostKeyword, data.Host)
+	}
+	return s, nil
+}
+
+// run renders and runs the hook, and returns an error if it fails. stdin is
+// written to the standard input of the script if it is not nil.
+func (h *hook) run(ctx context.Context, data *templateData, stdin []byte, updateID string) error {
+	_, err := h.execute(ctx, data, stdin, updateID, false)
+	return err
+}
+
+// eval renders and runs the hook like run, and returns its standard output
+// instead of logging it.
+func (h *hook) eval(ctx context.Context, data *templateData, updateID string) (string, error) {
+	return h.execute(ctx, data, nil, updateID, true)
+}
+
+func (h *hook) execute(ctx context.Context, data *templateData, stdin []byte, updateID string, capture bool) (stdout string, err error) {
+	runner, err := h.render(data)
+	if err != nil {
+		logger.Error().Str("script", h.name).Err(err).Msg("Failed to render script")
+		return "", err
+	}
+	output := newScriptOutput(h.name, updateID, *scriptLimit, *scriptTail)
+	opts := &shell.Options{
+		Env:          scriptEnv(data),
+		Stdout:       output.stdout,
+		Stderr:       output.stderr,
+		Timeout:      time.Duration(*scriptTimeout) * time.Millisecond,
+		GracePeriod:  time.Duration(*scriptGrace) * time.Millisecond,
+		Restrictions: restrictions,
+	}
+	if stdin != nil {
+		opts.Stdin = bytes.NewReader(stdin)
+	}
+	scriptCtx, done, ok := scripts.begin(ctx)
+	if !ok {
+		return "", errShuttingDown
+	}
+	var errorCode int
+	if capture {
+		stdout, errorCode = shell.Output(scriptCtx, runner, opts)
+	} else {
+		errorCode = runner.RunContext(scriptCtx, opts)
+	}
+	interrupted := scriptCtx.Err() != nil
+	done()
+	output.flush()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if interrupted {
+		return "", errShuttingDown
+	}
+	if errorCode == shell.ErrorCodeTimeout {
+		scriptFields(logger.Warning(), runner).Str("updateID", updateID).Str("timeout", opts.Timeout.String()).Strs("output", output.lastLines()).Msg("Script timed out")
+		return "", fmt.Errorf("script timed out after %s", opts.Timeout)
+	}
+	if errorCode != 0 {
+		scriptFields(logger.Warning().Int("errorCode", errorCode), runner).Str("updateID", updateID).Strs("output", output.lastLines()).Msg("Script exited with failure")
+		return "", fmt.Errorf("script exited with error code %d", errorCode)
+	}
+	return stdout, nil
+}
+
+// probe runs the probe of the address of u, or of the address reported by
+// the server when u is nil, and returns the published address it prints.
+func probe(ctx context.Context, u *client.Update) (string, error) {
+	data := &templateData{Event: "probe", Time: time.Now()}
+	updateID := ""
+	if u != nil {
+		data = newTemplateData(u)
+		data.Event = "probe"
+		updateID = u.ID
+	}
+	published, err := probeHook.eval(ctx, data, updateID)
+	return strings.TrimSpace(published), err
+}
+
+// startupProbeTimeout bounds the probe run on startup if -scripttimeout is not
+// set, so that a hanging probe does not keep the client from starting.
+const startupProbeTimeout = 30 * time.Second
+
+// probePublished runs the probe on startup, and returns the published
+// addresses it prints, separated by white space.
+func probePublished() []net.IP {
+	timeout := time.Duration(*scriptTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = startupProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	published, err := probe(ctx, nil)
+	if ctx.Err() != nil {
+		logger.Warning().Str("timeout", timeout.String()).Msg("Probe of published address timed out")
+		return nil
+	}
+	if err != nil {
+		logger.Warning().Err(err).Msg("Failed to probe published address")
+		return nil
+	}
+	ips := parsePublished(published)
+	for _, ip := range ips {
+		logger.Info().Str("published", ip.String()).Msg("Probed published address")
+	}
+	return ips
+}
+
+// parsePublished returns the addresses printed by the probe, separated by
+// whitespace. Other words, such as the CNAME records printed by dig +short,
+// are skipped.
+func parsePublished(output string) []net.IP {
+	var ips []net.IP
+	for _, field := range strings.Fields(output) {
+		ip := net.ParseIP(field)
+		if ip == nil {
+			logger.Debug().Str("published", field).Msg("Skipping probe output that is not an address")
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// scriptFields adds the fields describing the script or the command run by
+// runner to event.
+func scriptFields(event *zerolog.Event, runner shell.Runner) *zerolog.Event {
+	switch r := runner.(type) {
+	case shell.Command:
+		return event.Str("command", r.String())
+	case shell.Script:
+		return event.Str("shell", shell.Shell+" {{script}}").Str("script", string(r))
+	}
+	return event
+}
+
+// eventHookFlag is a flag specifying the hook of an event.
+type eventHookFlag struct {
+	name   string
+	event  string
+	script *string
+}
+
+// hookWorkers is the number of event hooks run at the same time, and
+// maxPendingHooks the number of events queued while they are busy; events
+// beyond it are dropped.
+const (
+	hookWorkers     = 4
+	maxPendingHooks = 64
+)
+
+var (
+	eventHooks = make(map[string]*hook)
+
+	// hookQueue holds the keys with pending hooks. The hooks of a key are
+	// run in order by a single worker, so that the hooks of a client, or of
+	// a server, finish in the order of their events.
+	hookQueue    = make(chan string, maxPendingHooks)
+	hookMutex    sync.Mutex
+	pendingHooks = make(map[string][]func())
+	pendingCount int
+	droppedHooks int
+)
+
+// parseEventHooks parses the hooks specified with flags, and returns the name
+// of the flag whose hook is invalid along with the error.
+func parseEventHooks(flags []eventHookFlag) (string, error) {
+	for _, f := range flags {
+		if *f.script == "" {
+			continue
+		}
+		h, err := newHook(f.event, *f.script)
+		if err != nil {
+			return f.name, err
+		}
+		eventHooks[f.event] = h
+	}
+	return "", nil
+}
+
+type eventDocument struct {
+	Event    string    `json:"event"`
+	Family   string    `json:"family,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	Server   string    `json:"server,omitempty"`
+	Client   string    `json:"client,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// eventStdin returns the JSON document of the event written to the standard
+// input of the hook with -stdinjson, or nil.
+func eventStdin(data *templateData) []byte {
+	if !*stdinJSON {
+		return nil
+	}
+	doc := &eventDocument{
+		Event:    data.Event,
+		Family:   data.Family,
+		Host:     data.Host,
+		Address:  data.IP,
+		Server:   data.Server,
+		Client:   data.Client,
+		Duration: data.Duration,
+		Error:    data.Error,
+		Time:     data.Time,
+	}
+	if data.Port != "" {
+		doc.Server = net.JoinHostPort(data.Server, data.Port)
+	}
+	stdin, err := json.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	return append(stdin, '\n')
+}
+
+// queueHook queues a hook after the pending hooks of key, so that the session
+// is not blocked while the hook runs.
+func queueHook(event, key string, run func()) {
+	hookMutex.Lock()
+	if pendingCount >= maxPendingHooks {
+		droppedHooks++
+		dropped := droppedHooks
+		hookMutex.Unlock()
+		logger.Warning().Str("event", event).Int("pending", maxPendingHooks).Int("dropped", dropped).Msg("Too many pending hooks, dropping event")
+		return
+	}
+	pendingCount++
+	queue, queued := pendingHooks[key]
+	pendingHooks[key] = append(queue, run)
+	hookMutex.Unlock()
+	if !queued {
+		// Each queued key has a pending hook, so this never blocks.
+		hookQueue <- key
+	}
+}
+
+// nextHook removes the next pending hook of key, and returns nil once there
+// are none left.
+func nextHook(key string) func() {
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+	queue := pendingHooks[key]
+	if len(queue) == 0 {
+		delete(pendingHooks, key)
+		return nil
+	}
+	pendingHooks[key] = queue[1:]
+	return queue[0]
+}
+
+// startHookWorkers starts the workers running the queued hooks. The hooks of
+// different keys may run concurrently, those of the same key run in order.
+func startHookWorkers() {
+	for i := 0; i < hookWorkers; i++ {
+		go func() {
+			for key := range hookQueue {
+				for run := nextHook(key); run != nil; run = nextHook(key) {
+					run()
+					hookMutex.Lock()
+					pendingCount--
+					hookMutex.Unlock()
+				}
+			}
+		}()
+	}
+}
+
+func onEvent(e *client.Event) {
+	h := eventHooks[e.Type]
+	if h == nil {
+		return
+	}
+	data := newEventData(e)
+	queueHook(e.Type, e.Server, func() {
+		_ = h.run(context.Background(), data, eventStdin(data), e.ID)
+	})
+}
+
+// onSession returns the callback of the server running the hook of event, or
+// nil if there is no such hook. These hooks are how the server updates DNS for
+// its clients; the updater of the client, with its retries, state file and
+// stabilization, is not run in server mode.
+func onSession(event string) func(session *server.Session) {
+	h := eventHooks[event]
+	if h == nil {
+		return nil
+	}
+	return func(session *server.Session) {
+		data := newSessionData(event, session)
+		// Without a certificate, a client reconnecting from another address
+		// cannot be told apart from other clients, so the hooks of all such
+		// clients are run in order.
+		queueHook(event, session.Identity, func() {
+			_ = h.run(context.Background(), data, eventStdin(data), "")
+		})
+	}
+}
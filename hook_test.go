@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueHookOrder(t *testing.T) {
+	startHookWorkers()
+	keys := []string{"a", "b", "c"}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	got := make(map[string][]int)
+	for i := 0; i < 10; i++ {
+		for _, key := range keys {
+			i, key := i, key
+			wg.Add(1)
+			queueHook("test", key, func() {
+				defer wg.Done()
+				// Later hooks are faster, so they would finish first if
+				// the hooks of a key ran concurrently.
+				time.Sleep(time.Duration(10-i) * time.Millisecond)
+				mutex.Lock()
+				got[key] = append(got[key], i)
+				mutex.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+	for _, key := range keys {
+		if len(got[key]) != 10 {
+			t.Fatalf("hooks of %q ran %d times, want 10", key, len(got[key]))
+		}
+		for i, n := range got[key] {
+			if n != i {
+				t.Errorf("hooks of %q finished in order %v, want the order of their events", key, got[key])
+				break
+			}
+		}
+	}
+}
+
+func TestParsePublished(t *testing.T) {
+	tests := []struct {
+		output string
+		ip     string
+		want   bool
+	}{
+		{"192.0.2.1\n", "192.0.2.1", true},
+		{"192.0.2.2\n", "192.0.2.1", false},
+		{"192.0.2.1 2001:db8::1\n", "2001:db8::1", true},
+		{"192.0.2.1\n2001:db8::1\n", "192.0.2.1", true},
+		{"home.example.net.\n192.0.2.1\n", "192.0.2.1", true},
+		{"home.example.net.\n", "192.0.2.1", false},
+		{"", "192.0.2.1", false},
+	}
+	for _, test := range tests {
+		got := containsIP(parsePublished(test.output), net.ParseIP(test.ip))
+		if got != test.want {
+			t.Errorf("parsePublished(%q) contains %s = %t, want %t", test.output, test.ip, got, test.want)
+		}
+	}
+}
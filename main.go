@@ -1,21 +1,30 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/zhouchenh/active-ddns/client"
+	"github.com/zhouchenh/active-ddns/dnscheck"
 	"github.com/zhouchenh/active-ddns/doublable"
 	"github.com/zhouchenh/active-ddns/info"
 	"github.com/zhouchenh/active-ddns/logger"
+	"github.com/zhouchenh/active-ddns/netwatch"
 	"github.com/zhouchenh/active-ddns/server"
 	"github.com/zhouchenh/active-ddns/shell"
+	"github.com/zhouchenh/active-ddns/starscript"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 func main() {
+	shell.Trampoline()
 	flag.Parse()
 	if *version {
 		printVersion()
@@ -26,6 +35,16 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *serverListenAddr != "" && *srvDomain != "" {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -s and -srv cannot be set together\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *clientConnectAddr != "" && *srvDomain != "" {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -c and -srv cannot be set together\n")
+		flag.Usage()
+		os.Exit(2)
+	}
 	if *hbiValue <= 0 {
 		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -hbi: value out of range\n", *hbiValue)
 		flag.Usage()
@@ -36,10 +55,35 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *scriptTimeout < 0 {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -scripttimeout: value out of range\n", *scriptTimeout)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *scriptLimit < 0 {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -scriptlimit: value out of range\n", *scriptLimit)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *scriptTail < 0 {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -scripttail: value out of range\n", *scriptTail)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *scriptGrace <= 0 {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -scriptgrace: value out of range\n", *scriptGrace)
+		flag.Usage()
+		os.Exit(2)
+	}
 	logger.SetTimestamp(*logTime)
 	logger.SetLogLevel(logLevel())
 	if *shellArgs != "" {
-		shell.Shell = *shellArgs
+		err := shell.SetShell(*shellArgs)
+		if err != nil {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -shell: %s\n", *shellArgs, err)
+			flag.Usage()
+			os.Exit(2)
+		}
 	}
 	if *serverListenAddr != "" {
 		if !*noTLS && (*certFilePath == "" || *keyFilePath == "") {
@@ -47,8 +91,30 @@ func main() {
 			flag.Usage()
 			os.Exit(2)
 		}
+		if *noTLS && *clientCAFile != "" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -notls and -clientca cannot be set together\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *onConnect != "" || *onDisconnect != "" {
+			if *keyword == "" {
+				_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a non-empty keyword should be specified with -keyword\n")
+				flag.Usage()
+				os.Exit(2)
+			}
+			parseRestrictions()
+		}
+		name, err := parseEventHooks([]eventHookFlag{
+			{"onconnect", client.EventConnected, onConnect},
+			{"ondisconnect", client.EventDisconnected, onDisconnect},
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -%s: %s\n", name, err)
+			flag.Usage()
+			os.Exit(2)
+		}
 		runServer()
-	} else if *clientConnectAddr != "" {
+	} else if *clientConnectAddr != "" || *srvDomain != "" {
 		if *minRI < 0 {
 			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -minri: value out of range\n", *minRI)
 			flag.Usage()
@@ -59,8 +125,38 @@ func main() {
 			flag.Usage()
 			os.Exit(2)
 		}
-		if *script == "" {
-			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a script should be specified with -script\n")
+		if *minRTI < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -minrti: value out of range\n", *minRTI)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *maxRTI < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -maxrti: value out of range\n", *maxRTI)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *maxRetries < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -retries: value out of range\n", *maxRetries)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *stableTime < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -stabletime: value out of range\n", *stableTime)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *stableSessions < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -stablesessions: value out of range\n", *stableSessions)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *script == "" && *starlarkFile == "" && *outputPath == "" && !*once {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a script should be specified with -script or -starlark, or an output file with -output\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *script != "" && *starlarkFile != "" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -script and -starlark cannot be set together\n")
 			flag.Usage()
 			os.Exit(2)
 		}
@@ -69,21 +165,276 @@ func main() {
 			flag.Usage()
 			os.Exit(2)
 		}
-		if !*noTLS && *tlsServerName == "" {
-			host, _ := splitHostPort(*clientConnectAddr)
-			if host == "" || net.ParseIP(host) != nil {
-				_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a valid server name should be specified with -servername\n")
+		if *verifyTimeout < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -verify: value out of range\n", *verifyTimeout)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *verifyInterval <= 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -verifyinterval: value out of range\n", *verifyInterval)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *verifyTimeout > 0 && *checkHostname == "" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a hostname should be specified with -check when -verify is set\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *ipv4Only && *ipv6Only {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -4 and -6 cannot be set together\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if ip := net.ParseIP(*localAddr); *localAddr != "" && ip == nil {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -bind: invalid IP address\n", *localAddr)
+			flag.Usage()
+			os.Exit(2)
+		} else if ip != nil && (*ipv4Only && ip.To4() == nil || *ipv6Only && ip.To4() != nil) {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "the address specified with -bind does not match the address family\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *watchNetwork && !netwatch.Supported {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -watch is not supported on this platform\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *watchNetwork && *netnsPath != "" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -watch and -netns cannot be set together\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *srvDomain != "" && *quorumValue > 1 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -srv and -quorum cannot be set together\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *srvDomain != "" && *tlsServerName != "" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -srv and -servername cannot be set together\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *quorumValue < 1 || *quorumValue > len(strings.Split(*clientConnectAddr, ",")) {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -quorum: value out of range\n", *quorumValue)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *failoverMode != "" && *failoverMode != client.FailoverPriority && *failoverMode != client.FailoverRoundRobin {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -failover: undefined failover mode\n", *failoverMode)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *failoverMode != "" && *quorumValue > 1 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -failover and -quorum cannot be set together\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *failAfter <= 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -failafter: value out of range\n", *failAfter)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *preferInterval < 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -preferinterval: value out of range\n", *preferInterval)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *srvDomain != "" && *failoverMode == "" {
+			*failoverMode = client.FailoverPriority
+		}
+		if *outputFormat != "text" && *outputFormat != "json" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -outputformat: undefined output format\n", *outputFormat)
+			flag.Usage()
+			os.Exit(2)
+		}
+		perm, err := strconv.ParseUint(*outputPerm, 8, 32)
+		if err != nil || perm > 0777 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -outputperm: invalid file mode\n", *outputPerm)
+			flag.Usage()
+			os.Exit(2)
+		}
+		outputFileMode = os.FileMode(perm)
+		if (*certFilePath == "") != (*keyFilePath == "") {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a certificate and private key should be specified together with -cert and -key\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *certFilePath != "" {
+			cert, err := tls.LoadX509KeyPair(*certFilePath, *keyFilePath)
+			if err != nil {
+				_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -cert and -key: %s\n", err)
 				flag.Usage()
 				os.Exit(2)
 			}
-			*tlsServerName = host
+			clientCertificate = &cert
+		}
+		if *script != "" {
+			updateHook, err = newHook("update", *script)
+			if err != nil {
+				_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -script: %s\n", err)
+				flag.Usage()
+				os.Exit(2)
+			}
+		}
+		if *starlarkFile != "" {
+			starlarkScript, err = starscript.Load(*starlarkFile, *scriptDir)
+			if err != nil {
+				_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -starlark: %s\n", err)
+				flag.Usage()
+				os.Exit(2)
+			}
+		}
+		if *probeScript != "" {
+			probeHook, err = newHook("probe", *probeScript)
+			if err != nil {
+				_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -probe: %s\n", err)
+				flag.Usage()
+				os.Exit(2)
+			}
+		}
+		name, err := parseEventHooks([]eventHookFlag{
+			{"onconnect", client.EventConnected, onConnect},
+			{"ondisconnect", client.EventDisconnected, onDisconnect},
+			{"onoutage", client.EventOutage, onOutage},
+			{"onrecover", client.EventRecovered, onRecover},
+			{"onupdatefail", client.EventUpdateFailed, onUpdateFail},
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -%s: %s\n", name, err)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if updateHook != nil || starlarkScript != nil || probeHook != nil || len(eventHooks) > 0 {
+			parseRestrictions()
+		}
+		if starlarkScript != nil && updateHook == nil && probeHook == nil && len(eventHooks) == 0 {
+			// The Starlark script runs in-process, so only -scriptdir applies
+			// to it.
+			for _, f := range []struct {
+				name string
+				set  bool
+			}{
+				{"scriptuser", *scriptUser != ""},
+				{"scriptgroup", *scriptGroup != ""},
+				{"scriptenv", *scriptEnvNames != ""},
+				{"scriptumask", *scriptUmask != ""},
+				{"scriptcpu", *scriptCPU != 0},
+				{"scriptnofile", *scriptNoFile != 0},
+			} {
+				if f.set {
+					_, _ = fmt.Fprintf(flag.CommandLine.Output(), "flag -%s does not apply to the Starlark script, which runs in-process\n", f.name)
+					flag.Usage()
+					os.Exit(2)
+				}
+			}
+		}
+		if *outageTime <= 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -outagetime: value out of range\n", *outageTime)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *prefixLength < 0 || *prefixLength > 128 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -prefixlen: value out of range\n", *prefixLength)
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *hostList != "" && *prefixLength == 0 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a prefix length should be specified with -prefixlen when -hosts is set\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if *hostList != "" && *hostKeyword == "" {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a non-empty keyword should be specified with -hostkeyword\n")
+			flag.Usage()
+			os.Exit(2)
+		}
+		hosts, err := parseHosts(*hostList)
+		if err != nil {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -hosts: %s\n", *hostList, err)
+			flag.Usage()
+			os.Exit(2)
+		}
+		var endpoints []client.Endpoint
+		if *clientConnectAddr != "" {
+			for _, addr := range strings.Split(*clientConnectAddr, ",") {
+				ep := client.Endpoint{Addr: strings.TrimSpace(addr), ServerName: *tlsServerName}
+				if !*noTLS && ep.ServerName == "" {
+					host, _ := splitHostPort(ep.Addr)
+					if host == "" || net.ParseIP(host) != nil {
+						_, _ = fmt.Fprintf(flag.CommandLine.Output(), "a valid server name should be specified with -servername\n")
+						flag.Usage()
+						os.Exit(2)
+					}
+					ep.ServerName = host
+				}
+				endpoints = append(endpoints, ep)
+			}
+		}
+		if *once {
+			runOnce(endpoints, hosts)
+		} else {
+			runClient(endpoints, hosts)
 		}
-		runClient()
 	} else {
 		flag.Usage()
 	}
 }
 
+// parseRestrictions checks the flags restricting the scripts and sets
+// restrictions. It is only called in the modes running scripts, so that the
+// flags do not need to be valid otherwise.
+func parseRestrictions() {
+	if *scriptCPU < 0 {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -scriptcpu: value out of range\n", *scriptCPU)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *scriptNoFile < 0 {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%d\" for flag -scriptnofile: value out of range\n", *scriptNoFile)
+		flag.Usage()
+		os.Exit(2)
+	}
+	restrictions = &shell.Restrictions{
+		User:      *scriptUser,
+		Group:     *scriptGroup,
+		Dir:       *scriptDir,
+		Umask:     -1,
+		CPUTime:   time.Duration(*scriptCPU) * time.Millisecond,
+		OpenFiles: uint64(*scriptNoFile),
+	}
+	if *scriptUmask != "" {
+		umask, err := strconv.ParseUint(*scriptUmask, 8, 32)
+		if err != nil || umask > 0777 {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -scriptumask: invalid file mode\n", *scriptUmask)
+			flag.Usage()
+			os.Exit(2)
+		}
+		restrictions.Umask = int(umask)
+	}
+	if *scriptEnvNames != "" {
+		for _, name := range strings.Split(*scriptEnvNames, ",") {
+			restrictions.Env = append(restrictions.Env, strings.TrimSpace(name))
+		}
+	}
+	if *scriptDir != "" {
+		info, err := os.Stat(*scriptDir)
+		if err == nil && !info.IsDir() {
+			err = errors.New("not a directory")
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value \"%s\" for flag -scriptdir: %s\n", *scriptDir, err)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	err := restrictions.Validate()
+	if err != nil {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "invalid value for flag -scriptuser or -scriptgroup: %s\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
 func printVersion() {
 	for _, s := range info.VersionStatement() {
 		_, _ = fmt.Fprintln(logger.Output(), s)
@@ -110,38 +461,231 @@ func logLevel() logger.Level {
 	return 0
 }
 
+func network() string {
+	if *ipv4Only {
+		return "tcp4"
+	} else if *ipv6Only {
+		return "tcp6"
+	}
+	return "tcp"
+}
+
 func runServer() {
 	s := &server.Server{
 		ListenAddr:              *serverListenAddr,
 		NoTLS:                   *noTLS,
 		CertFile:                *certFilePath,
 		KeyFile:                 *keyFilePath,
+		ClientCAFile:            *clientCAFile,
 		HeartbeatInterval:       time.Duration(*hbiValue) * time.Millisecond,
 		MissedHeartbeatsAllowed: *mhbValue,
+		OnConnect:               onSession(client.EventConnected),
+		OnDisconnect:            onSession(client.EventDisconnected),
 	}
 	printVersion()
+	go handleShutdown(0)
+	if len(eventHooks) > 0 {
+		startHookWorkers()
+	}
 	logger.Fatal().Msg(s.Run().Error())
 }
 
-func runClient() {
-	c := &client.Client{
-		ConnectAddr:             *clientConnectAddr,
+func newClient(endpoints []client.Endpoint, hosts []client.Host) *client.Client {
+	if *checkHostname != "" {
+		checker = &dnscheck.Checker{
+			Hostname: *checkHostname,
+			Resolver: *resolverAddr,
+			Timeout:  time.Duration(*verifyTimeout) * time.Millisecond,
+			Interval: time.Duration(*verifyInterval) * time.Millisecond,
+		}
+	}
+	return &client.Client{
+		Endpoints:               endpoints,
+		Discovery:               *srvDomain,
+		Network:                 network(),
+		HappyEyeballs:           *happyEyeballs,
+		LocalAddr:               *localAddr,
+		Interface:               *bindInterface,
+		Mark:                    *fwMark,
+		NetNS:                   *netnsPath,
 		NoTLS:                   *noTLS,
 		AllowInsecureTLS:        *insecureTLS,
-		ServerName:              *tlsServerName,
+		Certificate:             clientCertificate,
 		HeartbeatInterval:       time.Duration(*hbiValue) * time.Millisecond,
 		MissedHeartbeatsAllowed: *mhbValue,
 		RedialInterval:          &doublable.Duration{Min: time.Duration(*minRI) * time.Millisecond, Max: time.Duration(*maxRI) * time.Millisecond},
+		Failover:                *failoverMode,
+		FailoverAfter:           *failAfter,
+		PreferInterval:          time.Duration(*preferInterval) * time.Millisecond,
+		Quorum:                  *quorumValue,
+		RetryInterval:           &doublable.Duration{Min: time.Duration(*minRTI) * time.Millisecond, Max: time.Duration(*maxRTI) * time.Millisecond},
+		MaxRetries:              *maxRetries,
+		StateFile:               *stateFilePath,
+		StableDuration:          time.Duration(*stableTime) * time.Millisecond,
+		StableSessions:          *stableSessions,
+		PrefixLength:            *prefixLength,
+		Hosts:                   hosts,
+		OnIPAddrReport:          onIPAddrReport,
 		OnIPAddrUpdate:          onIPAddrUpdate,
+		OutageThreshold:         time.Duration(*outageTime) * time.Millisecond,
 	}
+}
+
+func runClient(endpoints []client.Endpoint, hosts []client.Host) {
+	c := newClient(endpoints, hosts)
 	printVersion()
+	go handleShutdown(0)
+	if *outputPath != "" {
+		loadOutput()
+	}
+	if probeHook != nil {
+		c.Published = probePublished()
+	}
+	if len(eventHooks) > 0 {
+		c.OnEvent = onEvent
+		startHookWorkers()
+	}
+	if *watchNetwork {
+		go watch(c)
+	}
 	logger.Fatal().Msg(c.Run().Error())
 }
 
-func onIPAddrUpdate(newIPAddr net.IP) {
-	scriptString := strings.ReplaceAll(*script, *keyword, newIPAddr.String())
-	errorCode := shell.Script(scriptString).Run()
-	if errorCode != 0 {
-		logger.Warning().Int("errorCode", errorCode).Str("shell", shell.Shell+" {{script}}").Str("script", scriptString).Msg("Script exited with failure")
+var errShuttingDown = errors.New("shutting down")
+
+var (
+	checker           *dnscheck.Checker
+	outputFileMode    os.FileMode
+	updateHook        *hook
+	probeHook         *hook
+	starlarkScript    *starscript.Script
+	restrictions      *shell.Restrictions
+	clientCertificate *tls.Certificate
+)
+
+// checkerFor returns the checker of the DNS record updated by u. The record of
+// a LAN host is looked up by the host name.
+func checkerFor(u *client.Update) *dnscheck.Checker {
+	if checker == nil || u.Host == "" {
+		return checker
+	}
+	return &dnscheck.Checker{
+		Hostname: u.Host,
+		Resolver: checker.Resolver,
+		Timeout:  checker.Timeout,
+		Interval: checker.Interval,
+	}
+}
+
+func watch(c *client.Client) {
+	var interfaces []string
+	if *watchInterfaces != "" {
+		for _, name := range strings.Split(*watchInterfaces, ",") {
+			interfaces = append(interfaces, strings.TrimSpace(name))
+		}
+	} else if *bindInterface != "" {
+		interfaces = []string{*bindInterface}
+	}
+	err := netwatch.Watch(interfaces, 500*time.Millisecond, func(name string) {
+		logger.Info().Str("interface", name).Msg("Network changed, reconnecting")
+		c.Redial()
+	})
+	logger.Error().Err(err).Msg("Failed to watch network changes")
+}
+
+// onIPAddrReport writes the output file with the address reported by a
+// session, even if it is already published and its update is skipped.
+func onIPAddrReport(u *client.Update) {
+	if *outputPath == "" {
+		return
+	}
+	err := writeOutput(u, outputFileMode, nil)
+	if err != nil {
+		logger.Error().Str("file", *outputPath).Err(err).Msg("Failed to write output file")
+		return
+	}
+	logger.Debug().Str("file", *outputPath).Str("address", u.IPAddr.String()).Msg("Wrote output file")
+}
+
+func onIPAddrUpdate(ctx context.Context, u *client.Update) error {
+	if *script == "" && starlarkScript == nil {
+		return nil
+	}
+	checker := checkerFor(u)
+	if checker != nil {
+		matches, addrs, err := checker.Matches(ctx, u.IPAddr)
+		if err != nil {
+			logger.Warning().Str("hostname", checker.Hostname).Err(err).Msg("Failed to check DNS record")
+		} else if matches {
+			logger.Info().Str("hostname", checker.Hostname).Str("address", u.IPAddr.String()).Msg("DNS record is up to date, skipping update")
+			return nil
+		} else {
+			logger.Debug().Str("hostname", checker.Hostname).Str("records", joinIPs(addrs)).Msg("DNS record differs from the new address")
+		}
+	}
+	if probeHook != nil {
+		published, err := probe(ctx, u)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Warning().Err(err).Msg("Failed to probe published address")
+		} else if containsIP(parsePublished(published), u.IPAddr) {
+			logger.Info().Str("address", u.IPAddr.String()).Msg("Published address is up to date, no change needed")
+			return nil
+		} else {
+			logger.Debug().Str("address", u.IPAddr.String()).Str("published", published).Msg("Published address differs from the new address")
+		}
+	}
+	if starlarkScript != nil {
+		callCtx := ctx
+		timeout := time.Duration(*scriptTimeout) * time.Millisecond
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		err := starlarkScript.OnUpdate(callCtx, updateFields(newTemplateData(u), u.ID))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if callCtx.Err() != nil {
+			logger.Warning().Str("script", *starlarkFile).Str("updateID", u.ID).Str("timeout", timeout.String()).Msg("Starlark on_update timed out")
+			return callCtx.Err()
+		}
+		if err != nil {
+			logger.Warning().Str("script", *starlarkFile).Str("updateID", u.ID).Err(err).Msg("Starlark on_update failed")
+			return err
+		}
+	} else {
+		var stdin []byte
+		if *stdinJSON {
+			doc := newOutputDocument(u)
+			doc.Event = "update"
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			stdin = append(data, '\n')
+		}
+		err := updateHook.run(ctx, newTemplateData(u), stdin, u.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if checker != nil && checker.Timeout > 0 {
+		result := checker.WaitForPropagation(ctx, u.IPAddr)
+		if result.Propagated {
+			logger.Info().Str("hostname", checker.Hostname).Str("address", u.IPAddr.String()).Str("elapsed", result.Elapsed.String()).Msg("DNS record propagated")
+		} else {
+			logger.Warning().Str("hostname", checker.Hostname).Str("address", u.IPAddr.String()).Str("records", joinIPs(result.Addresses)).Str("elapsed", result.Elapsed.String()).Msg("DNS record did not propagate in time")
+		}
+		if *outputPath != "" && u.Host == "" && *outputFormat == "json" {
+			err := writeOutput(u, outputFileMode, &result)
+			if err != nil {
+				logger.Error().Str("file", *outputPath).Err(err).Msg("Failed to write output file")
+			}
+		}
 	}
+	return nil
 }
@@ -0,0 +1,33 @@
+package netwatch
+
+import (
+	"sync"
+	"time"
+)
+
+type debouncer struct {
+	delay    time.Duration
+	onChange func(name string)
+	mutex    sync.Mutex
+	timer    *time.Timer
+	name     string
+}
+
+func newDebouncer(delay time.Duration, onChange func(name string)) *debouncer {
+	return &debouncer{delay: delay, onChange: onChange}
+}
+
+func (d *debouncer) trigger(name string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.name = name
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, func() {
+		d.mutex.Lock()
+		name := d.name
+		d.mutex.Unlock()
+		d.onChange(name)
+	})
+}
@@ -0,0 +1,241 @@
+package netwatch
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const Supported = true
+
+// rtnetlink multicast groups from linux/rtnetlink.h, which the syscall
+// package does not define.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// Watch subscribes to rtnetlink notifications of link, address and route
+// changes, and calls onChange with the name of the affected interface once
+// no further change of the interfaces has been seen for delay. If interfaces
+// is empty, the interfaces which carry a default route are watched, and the
+// default routes being added or removed are reported as well, so that the
+// churn of other interfaces, such as those of containers, is ignored. Watch
+// only returns if the subscription fails.
+func Watch(interfaces []string, delay time.Duration, onChange func(name string)) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	groups := uint32(rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv4Route | rtmgrpIPv6IfAddr | rtmgrpIPv6Route)
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups})
+	if err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	w, err := newWatcher(interfaces)
+	if err != nil {
+		return err
+	}
+	d := newDebouncer(delay, onChange)
+	buffer := make([]byte, os.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EINTR || err == syscall.ENOBUFS {
+				continue
+			}
+			return os.NewSyscallError("recvfrom", err)
+		}
+		messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range messages {
+			if name, ok := w.handle(&m); ok {
+				d.trigger(name)
+			}
+		}
+	}
+}
+
+// watcher decides which changes are reported. It keeps the names of the
+// interfaces by index, so that the changes of an interface which has just
+// been removed are still attributed to it.
+type watcher struct {
+	interfaces []string
+	names      map[int]string
+	// defaults is the number of default routes through each interface, which
+	// is only kept if no interface is specified.
+	defaults map[int]int
+}
+
+func newWatcher(interfaces []string) (*watcher, error) {
+	w := &watcher{interfaces: interfaces, names: make(map[int]string)}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		w.names[iface.Index] = iface.Name
+	}
+	if len(interfaces) > 0 {
+		return w, nil
+	}
+	w.defaults = make(map[int]int)
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	messages, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	for _, m := range messages {
+		if m.Header.Type == syscall.RTM_NEWROUTE {
+			if index, ok := defaultRoute(&m); ok {
+				w.defaults[index]++
+			}
+		}
+	}
+	return w, nil
+}
+
+// handle returns the name of the interface affected by m, and whether the
+// change is reported.
+func (w *watcher) handle(m *syscall.NetlinkMessage) (string, bool) {
+	switch m.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		index, name := link(m)
+		if index == 0 {
+			return "", false
+		}
+		if name == "" {
+			name = w.names[index]
+		}
+		selected := name != "" && w.selected(index, name)
+		if m.Header.Type == syscall.RTM_NEWLINK {
+			w.names[index] = name
+		} else {
+			// The routes through the interface are removed with it, which is
+			// not always notified.
+			delete(w.names, index)
+			delete(w.defaults, index)
+		}
+		return name, selected
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(m.Data) < syscall.SizeofIfAddrmsg {
+			return "", false
+		}
+		index := int((*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0])).Index)
+		name := w.name(index)
+		return name, name != "" && w.selected(index, name)
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		if index, ok := defaultRoute(m); ok && w.defaults != nil {
+			if m.Header.Type == syscall.RTM_NEWROUTE {
+				w.defaults[index]++
+			} else if w.defaults[index]--; w.defaults[index] <= 0 {
+				delete(w.defaults, index)
+			}
+			return w.name(index), true
+		}
+		index := routeInterface(m)
+		if index == 0 {
+			return "", false
+		}
+		name := w.name(index)
+		return name, name != "" && w.selected(index, name)
+	}
+	return "", false
+}
+
+// selected reports whether changes of the interface are reported.
+func (w *watcher) selected(index int, name string) bool {
+	if len(w.interfaces) == 0 {
+		return w.defaults[index] > 0
+	}
+	for _, iface := range w.interfaces {
+		if iface == name {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the name of the interface at index, which is looked up if it
+// is not known yet.
+func (w *watcher) name(index int) string {
+	if name, ok := w.names[index]; ok {
+		return name
+	}
+	iface, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return ""
+	}
+	w.names[index] = iface.Name
+	return iface.Name
+}
+
+// link returns the index and the name of the interface of a link message.
+func link(m *syscall.NetlinkMessage) (index int, name string) {
+	if len(m.Data) < syscall.SizeofIfInfomsg {
+		return 0, ""
+	}
+	index = int((*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0])).Index)
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return index, ""
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type == syscall.IFLA_IFNAME {
+			return index, cString(attr.Value)
+		}
+	}
+	return index, ""
+}
+
+// defaultRoute returns the index of the output interface of a route message,
+// and whether the route is a unicast default route.
+func defaultRoute(m *syscall.NetlinkMessage) (int, bool) {
+	if len(m.Data) < syscall.SizeofRtMsg {
+		return 0, false
+	}
+	rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+	if rtm.Dst_len != 0 || rtm.Type != syscall.RTN_UNICAST {
+		return 0, false
+	}
+	index := routeInterface(m)
+	return index, index != 0
+}
+
+// routeInterface returns the index of the output interface of a route
+// message, or 0 if there is none.
+func routeInterface(m *syscall.NetlinkMessage) int {
+	if len(m.Data) < syscall.SizeofRtMsg {
+		return 0
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return 0
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type == syscall.RTA_OIF && len(attr.Value) >= 4 {
+			return int(*(*uint32)(unsafe.Pointer(&attr.Value[0])))
+		}
+	}
+	return 0
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package netwatch
+
+import (
+	"errors"
+	"time"
+)
+
+const Supported = false
+
+func Watch(_ []string, _ time.Duration, _ func(name string)) error {
+	return errors.New("watching network changes is not supported on this platform")
+}
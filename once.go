@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zhouchenh/active-ddns/client"
+	"github.com/zhouchenh/active-ddns/logger"
+	"os"
+	"time"
+)
+
+// Exit codes of -once. Exit code 1 is left to fatal errors and 2 to invalid
+// usage. exitInterrupted is used when stopped by SIGINT or SIGTERM.
+const (
+	exitSuccess           = 0
+	exitConnectionFailure = 3
+	exitTLSFailure        = 4
+	exitProtocolError     = 5
+	exitUpdateFailure     = 6
+	exitInterrupted       = 7
+)
+
+func runOnce(endpoints []client.Endpoint, hosts []client.Host) {
+	// Keep the standard output for the address.
+	logger.SetOutput(os.Stderr)
+	c := newClient(endpoints, hosts)
+	go handleShutdown(exitInterrupted)
+	ip, server, err := c.Query()
+	if err != nil {
+		logger.Error().Str("server", server).Err(err).Msg("Failed to query IP address")
+		os.Exit(queryExitCode(err))
+	}
+	switch *outputFormat {
+	case "json":
+		data, _ := json.Marshal(&outputDocument{
+			Family:  client.Family(ip),
+			Address: ip.String(),
+			Server:  server,
+			Time:    time.Now(),
+		})
+		_, _ = fmt.Println(string(data))
+	default:
+		_, _ = fmt.Println(ip.String())
+	}
+	if *script != "" || *starlarkFile != "" || *outputPath != "" {
+		if *outputPath != "" {
+			loadOutput()
+		}
+		err = c.Apply(server, ip)
+		if err != nil {
+			os.Exit(exitUpdateFailure)
+		}
+	}
+	os.Exit(exitSuccess)
+}
+
+func queryExitCode(err error) int {
+	var protocolErr *client.ProtocolError
+	if errors.As(err, &protocolErr) {
+		return exitProtocolError
+	} else if client.IsCertificateError(err) {
+		return exitTLSFailure
+	}
+	return exitConnectionFailure
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/zhouchenh/active-ddns/atomicfile"
+	"github.com/zhouchenh/active-ddns/client"
+	"github.com/zhouchenh/active-ddns/dnscheck"
+	"github.com/zhouchenh/active-ddns/logger"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// outputDocument is an address written to the output file, printed by -once
+// with -outputformat json, or passed to the update script with -stdinjson.
+// Event is only set for the update script, as in the documents passed to the
+// event hooks.
+type outputDocument struct {
+	Event      string    `json:"event,omitempty"`
+	Family     string    `json:"family"`
+	Host       string    `json:"host,omitempty"`
+	Address    string    `json:"address"`
+	OldAddress string    `json:"oldAddress,omitempty"`
+	Server     string    `json:"server,omitempty"`
+	Time       time.Time `json:"time"`
+	// Propagated is whether the updated DNS record propagated within the
+	// -verify timeout, and is only set once it has been verified.
+	Propagated *bool `json:"propagated,omitempty"`
+}
+
+func newOutputDocument(u *client.Update) *outputDocument {
+	doc := &outputDocument{
+		Family:  u.Family,
+		Host:    u.Host,
+		Address: u.IPAddr.String(),
+		Server:  u.Server,
+		Time:    u.Time,
+	}
+	if u.OldIPAddr != nil {
+		doc.OldAddress = u.OldIPAddr.String()
+	}
+	return doc
+}
+
+// outputFile is the content of the output file, which is the latest address
+// of each family, so that the update of one family does not remove the
+// address of the other one.
+type outputFile struct {
+	IPv4 *outputDocument `json:"ipv4,omitempty"`
+	IPv6 *outputDocument `json:"ipv6,omitempty"`
+}
+
+var (
+	outputMutex   sync.Mutex
+	outputContent outputFile
+)
+
+// loadOutput reads the addresses already in the output file, so that they are
+// kept until the address of their family is updated again.
+func loadOutput() {
+	data, err := os.ReadFile(*outputPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warning().Str("file", *outputPath).Err(err).Msg("Failed to read output file")
+		}
+		return
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if *outputFormat == "json" {
+		var content outputFile
+		err = json.Unmarshal(data, &content)
+		if err != nil {
+			logger.Warning().Str("file", *outputPath).Err(err).Msg("Failed to parse output file")
+			return
+		}
+		outputContent = content
+		return
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		ip := net.ParseIP(string(bytes.TrimSpace(line)))
+		if ip == nil {
+			continue
+		}
+		doc := &outputDocument{Family: client.Family(ip), Address: ip.String()}
+		if ip.To4() != nil {
+			outputContent.IPv4 = doc
+		} else {
+			outputContent.IPv6 = doc
+		}
+	}
+}
+
+// writeOutput atomically replaces the output file with the address of u and
+// the latest address of the other family, in the format specified with
+// -outputformat, which is one address per line, or a JSON document mapping
+// each family to its address. The result of the verification of the DNS
+// record is included in the JSON document if it is not nil.
+func writeOutput(u *client.Update, perm os.FileMode, verification *dnscheck.Result) error {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	doc := newOutputDocument(u)
+	if verification != nil {
+		doc.Propagated = &verification.Propagated
+	}
+	if u.IPAddr.To4() != nil {
+		outputContent.IPv4 = doc
+	} else {
+		outputContent.IPv6 = doc
+	}
+	var data []byte
+	switch *outputFormat {
+	case "json":
+		var err error
+		data, err = json.MarshalIndent(&outputContent, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	default:
+		for _, doc := range []*outputDocument{outputContent.IPv4, outputContent.IPv6} {
+			if doc != nil {
+				data = append(data, doc.Address+"\n"...)
+			}
+		}
+	}
+	return atomicfile.WriteFile(*outputPath, data, perm)
+}
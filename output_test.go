@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/zhouchenh/active-ddns/client"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setOutput sets the output flags for a test, and resets the content of the
+// output file.
+func setOutput(t *testing.T, path, format string) {
+	oldPath, oldFormat := *outputPath, *outputFormat
+	*outputPath, *outputFormat = path, format
+	outputContent = outputFile{}
+	t.Cleanup(func() {
+		*outputPath, *outputFormat = oldPath, oldFormat
+		outputContent = outputFile{}
+	})
+}
+
+func TestWriteOutputText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "address")
+	setOutput(t, path, "text")
+	steps := []struct {
+		address string
+		want    string
+	}{
+		{"2001:db8::1", "2001:db8::1\n"},
+		{"192.0.2.1", "192.0.2.1\n2001:db8::1\n"},
+		{"192.0.2.2", "192.0.2.2\n2001:db8::1\n"},
+		{"2001:db8::2", "192.0.2.2\n2001:db8::2\n"},
+	}
+	for _, step := range steps {
+		ip := net.ParseIP(step.address)
+		err := writeOutput(&client.Update{Family: client.Family(ip), IPAddr: ip}, 0644, nil)
+		if err != nil {
+			t.Fatalf("writeOutput(%s) error = %v", step.address, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != step.want {
+			t.Errorf("after writing %s, content = %q, want %q", step.address, data, step.want)
+		}
+	}
+}
+
+func TestLoadOutputText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "address")
+	setOutput(t, path, "text")
+	err := os.WriteFile(path, []byte("192.0.2.1\n2001:db8::1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadOutput()
+	ip := net.ParseIP("192.0.2.2")
+	err = writeOutput(&client.Update{Family: client.Family(ip), IPAddr: ip}, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "192.0.2.2\n2001:db8::1\n"; string(data) != want {
+		t.Errorf("content = %q, want %q", data, want)
+	}
+}
+
+func TestWriteOutputJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "address.json")
+	setOutput(t, path, "json")
+	ipv4, ipv6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	err := writeOutput(&client.Update{Family: "ipv4", IPAddr: ipv4}, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeOutput(&client.Update{Family: "ipv6", IPAddr: ipv6, OldIPAddr: net.ParseIP("2001:db8::2")}, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputContent = outputFile{}
+	loadOutput()
+	if outputContent.IPv4 == nil || outputContent.IPv4.Address != "192.0.2.1" {
+		t.Errorf("loaded IPv4 document = %+v, want address 192.0.2.1", outputContent.IPv4)
+	}
+	if outputContent.IPv6 == nil || outputContent.IPv6.Address != "2001:db8::1" || outputContent.IPv6.OldAddress != "2001:db8::2" {
+		t.Errorf("loaded IPv6 document = %+v, want address 2001:db8::1 and old address 2001:db8::2", outputContent.IPv6)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content map[string]map[string]interface{}
+	err = json.Unmarshal(data, &content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content["ipv4"]["family"] != "ipv4" || content["ipv6"]["family"] != "ipv6" {
+		t.Errorf("content = %s, want a document of each family", data)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"github.com/zhouchenh/active-ddns/logger"
+	"sync"
+)
+
+// maxLineLength is the length after which a line of script output is logged
+// even if it does not end yet.
+const maxLineLength = 4096
+
+// scriptOutput logs the output of a run of a script line by line, up to limit
+// bytes or without limit if it is 0, and keeps the last lines for the failure
+// warning. Lines written to the standard error are logged as warnings.
+type scriptOutput struct {
+	mutex     sync.Mutex
+	name      string
+	updateID  string
+	limit     int
+	logged    int
+	truncated bool
+	tail      []string
+	tailSize  int
+	stdout    *lineWriter
+	stderr    *lineWriter
+}
+
+func newScriptOutput(name, updateID string, limit, tailSize int) *scriptOutput {
+	o := &scriptOutput{name: name, updateID: updateID, limit: limit, tailSize: tailSize}
+	o.stdout = &lineWriter{output: o, stream: "stdout"}
+	o.stderr = &lineWriter{output: o, stream: "stderr"}
+	return o
+}
+
+// flush logs the last lines of both streams which do not end with a newline.
+// It is called once the script exits.
+func (o *scriptOutput) flush() {
+	o.stdout.flush()
+	o.stderr.flush()
+}
+
+func (o *scriptOutput) line(stream, line string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.tailSize > 0 {
+		if len(o.tail) == o.tailSize {
+			o.tail = o.tail[1:]
+		}
+		o.tail = append(o.tail, line)
+	}
+	if o.truncated {
+		return
+	}
+	if o.limit > 0 && o.logged+len(line) > o.limit {
+		o.truncated = true
+		logger.Warning().Str("script", o.name).Str("updateID", o.updateID).Int("limit", o.limit).Msg("Script output truncated")
+		return
+	}
+	o.logged += len(line)
+	event := logger.Info()
+	if stream == "stderr" {
+		event = logger.Warning()
+	}
+	event = event.Str("script", o.name).Str("stream", stream)
+	if o.updateID != "" {
+		event = event.Str("updateID", o.updateID)
+	}
+	event.Msg(line)
+}
+
+// lastLines returns the last lines of the output of both streams.
+func (o *scriptOutput) lastLines() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]string(nil), o.tail...)
+}
+
+// lineWriter splits the output of a stream into lines.
+type lineWriter struct {
+	output *scriptOutput
+	stream string
+	buffer []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i == -1 {
+			if len(w.buffer) < maxLineLength {
+				break
+			}
+			i = maxLineLength
+		}
+		w.output.line(w.stream, string(bytes.TrimRight(w.buffer[:i], "\r")))
+		if i < len(w.buffer) && w.buffer[i] == '\n' {
+			i++
+		}
+		w.buffer = w.buffer[i:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.buffer) > 0 {
+		w.output.line(w.stream, string(bytes.TrimRight(w.buffer, "\r")))
+		w.buffer = nil
+	}
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"github.com/zhouchenh/active-ddns/logger"
 	"github.com/zhouchenh/active-ddns/neterr"
 	"github.com/zhouchenh/active-ddns/ticker"
@@ -11,14 +13,29 @@ import (
 	"time"
 )
 
+// Session is a session with a client reported to OnConnect and OnDisconnect.
+// Identity is the common name, or the first DNS name, of the certificate of
+// the client if client certificates are required with ClientCAFile, and is
+// empty otherwise. OnConnect is called once the address is sent, before the
+// heartbeats start, so the heartbeats of the session wait for it to return.
+type Session struct {
+	ClientAddr string
+	IPAddr     net.IP
+	Identity   string
+	Connected  time.Time
+}
+
 type Server struct {
 	ListenAddr              string
 	NoTLS                   bool
 	CertFile                string
 	KeyFile                 string
+	ClientCAFile            string
 	HeartbeatInterval       time.Duration
 	MissedHeartbeatsAllowed int
 	idleTimeout             time.Duration
+	OnConnect               func(session *Session)
+	OnDisconnect            func(session *Session)
 }
 
 func (s *Server) Run() (err error) {
@@ -34,8 +51,21 @@ func (s *Server) Run() (err error) {
 		if err != nil {
 			return err
 		}
+		config := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if s.ClientCAFile != "" {
+			var pem []byte
+			pem, err = ioutil.ReadFile(s.ClientCAFile)
+			if err != nil {
+				return err
+			}
+			config.ClientCAs = x509.NewCertPool()
+			if !config.ClientCAs.AppendCertsFromPEM(pem) {
+				return errors.New("no certificate found in " + s.ClientCAFile)
+			}
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
 		listen = func() (net.Listener, error) {
-			return tls.Listen("tcp", s.ListenAddr, &tls.Config{Certificates: []tls.Certificate{cert}})
+			return tls.Listen("tcp", s.ListenAddr, config)
 		}
 	}
 	var listener net.Listener
@@ -67,6 +97,14 @@ func (s *Server) handleConn(conn net.Conn) {
 	if ipv4 := ip.To4(); ipv4 != nil {
 		ip = ipv4
 	}
+	identity, err := s.handshake(conn)
+	if err != nil {
+		neterr.LogError(err)
+		return
+	}
+	if identity != "" {
+		logger.Info().Str("client", remoteAddr).Str("identity", identity).Msg("Client authenticated")
+	}
 	data := append([]byte{byte(len(ip))}, []byte(ip)...)
 	length := len(data)
 	for written := 0; written < length; {
@@ -83,12 +121,48 @@ func (s *Server) handleConn(conn net.Conn) {
 		written += n
 	}
 	logger.Debug().Str("client", remoteAddr).Msg("Sent IP address")
+	session := &Session{ClientAddr: remoteAddr, IPAddr: ip, Identity: identity, Connected: time.Now()}
+	if s.OnConnect != nil {
+		s.OnConnect(session)
+	}
+	if s.OnDisconnect != nil {
+		defer s.OnDisconnect(session)
+	}
 	t := ticker.NewTicker(s.HeartbeatInterval)
 	defer t.Stop()
 	go s.sendHeartbeats(conn, t, remoteAddr)
 	s.receiveHeartbeats(conn, remoteAddr)
 }
 
+// handshake completes the TLS handshake, and returns the identity of the
+// client if client certificates are required.
+func (s *Server) handshake(conn net.Conn) (identity string, err error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+	err = tlsConn.SetDeadline(time.Now().Add(s.idleTimeout))
+	if err != nil {
+		return "", err
+	}
+	err = tlsConn.Handshake()
+	if err != nil {
+		return "", err
+	}
+	err = tlsConn.SetDeadline(time.Time{})
+	if err != nil {
+		return "", err
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", nil
+	}
+	if certs[0].Subject.CommonName != "" || len(certs[0].DNSNames) == 0 {
+		return certs[0].Subject.CommonName, nil
+	}
+	return certs[0].DNSNames[0], nil
+}
+
 func (s *Server) sendHeartbeats(conn net.Conn, t *ticker.Ticker, remoteAddr string) {
 	logger.Debug().Str("client", remoteAddr).Msg("Heartbeat started")
 	for {
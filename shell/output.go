@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// outputWaitDelay is the time output is still copied after the process exits,
+// since the processes it started may keep writing to it.
+const outputWaitDelay = time.Second
+
+// output is where the output of a process goes. Output to a writer other than
+// a file is copied through a pipe, so that waiting for the process does not
+// wait for the processes it started which still hold the pipe.
+type output struct {
+	file   *os.File
+	reader *os.File
+	done   chan struct{}
+}
+
+func newOutput(w io.Writer) (*output, error) {
+	if f, ok := w.(*os.File); ok {
+		return &output{file: f}, nil
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	o := &output{file: writer, reader: reader, done: make(chan struct{})}
+	go func() {
+		_, _ = io.Copy(w, reader)
+		close(o.done)
+	}()
+	return o, nil
+}
+
+// started closes the write end of the pipe once the process inherits it.
+func (o *output) started() {
+	if o.reader != nil {
+		_ = o.file.Close()
+	}
+}
+
+// close waits up to d for the output to be copied, and then closes the pipe.
+func (o *output) close(d time.Duration) {
+	if o.reader == nil {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-o.done:
+	case <-t.C:
+	}
+	_ = o.reader.Close()
+	<-o.done
+}
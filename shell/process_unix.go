@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd run in a process group of its own, so that the
+// processes it starts can be signalled together with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd.Process != nil {
+		_ = syscall.Kill(-cmd.Process.Pid, sig)
+	}
+}
+
+func interruptGroup(cmd *exec.Cmd) {
+	signalGroup(cmd, syscall.SIGINT)
+}
+
+func terminateGroup(cmd *exec.Cmd) {
+	signalGroup(cmd, syscall.SIGTERM)
+}
+
+func killGroup(cmd *exec.Cmd) {
+	signalGroup(cmd, syscall.SIGKILL)
+}
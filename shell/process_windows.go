@@ -0,0 +1,26 @@
+package shell
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func interruptGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Signal(os.Interrupt)
+	}
+}
+
+// terminateGroup kills the process of cmd at once, since there is no signal
+// asking a process to exit on Windows.
+func terminateGroup(cmd *exec.Cmd) {
+	killGroup(cmd)
+}
+
+func killGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,56 @@
+package shell
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Restrictions reduce the privileges of a script.
+type Restrictions struct {
+	// User is the name or the ID of the user the script runs as, with the
+	// primary group of the user unless Group is specified.
+	User string
+	// Group is the name or the ID of the group the script runs as.
+	Group string
+	// Env is the names of the environment variables inherited from the current
+	// process, or nil to inherit all of them.
+	Env []string
+	// Dir is the working directory of the script, or the current directory if
+	// empty.
+	Dir string
+	// Umask is the file mode creation mask of the script, or -1 to inherit it.
+	Umask int
+	// CPUTime is the CPU time the script may use, rounded up to seconds, or 0
+	// for no limit.
+	CPUTime time.Duration
+	// OpenFiles is the number of files the script may open, or 0 for no
+	// limit.
+	OpenFiles uint64
+}
+
+// environ returns the environment of a script, which is the allowed part of
+// the environment of the current process followed by env, or nil for the
+// unmodified environment of the current process.
+func environ(r *Restrictions, env []string) []string {
+	if r == nil || r.Env == nil {
+		if env == nil {
+			return nil
+		}
+		return append(os.Environ(), env...)
+	}
+	var allowed []string
+	for _, kv := range os.Environ() {
+		name := kv
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			name = kv[:i]
+		}
+		for _, n := range r.Env {
+			if n == name {
+				allowed = append(allowed, kv)
+				break
+			}
+		}
+	}
+	return append(allowed, env...)
+}
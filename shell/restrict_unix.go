@@ -0,0 +1,195 @@
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// trampolineArg0 is the first argument which makes the current executable
+// apply the umask and the resource limits of a script and execute it, since
+// they cannot be applied between fork and exec otherwise. The restrictions are
+// read from a pipe passed as trampolineFD rather than from the arguments or
+// the environment, which a script could pass on to another run of the
+// executable.
+const (
+	trampolineArg0 = "active-ddns-restrict"
+	trampolineFD   = 3
+)
+
+// Validate checks that the user and the group exist.
+func (r *Restrictions) Validate() error {
+	_, err := r.credential()
+	return err
+}
+
+func (r *Restrictions) credential() (*syscall.Credential, error) {
+	if r.User == "" && r.Group == "" {
+		return nil, nil
+	}
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), Groups: []uint32{}}
+	if r.User != "" {
+		u, err := lookupUser(r.User)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if r.Group != "" {
+		g, err := lookupGroup(r.Group)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return &user.Group{Gid: name}, nil
+	}
+	return user.LookupGroup(name)
+}
+
+// apply makes cmd run with the restrictions. The umask and the resource limits
+// are applied by the current executable started as a trampoline. The returned
+// function releases the resources used for the trampoline, and should be
+// called once cmd is started.
+func (r *Restrictions) apply(cmd *exec.Cmd) (release func(), err error) {
+	release = func() {}
+	cred, err := r.credential()
+	if err != nil {
+		return release, err
+	}
+	if cred != nil {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+	cmd.Dir = r.Dir
+	if r.Umask < 0 && r.CPUTime <= 0 && r.OpenFiles == 0 {
+		return release, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return release, err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return release, err
+	}
+	// The restrictions are much shorter than the capacity of the pipe, so the
+	// write does not block.
+	cpu := (r.CPUTime + time.Second - 1) / time.Second
+	_, err = fmt.Fprintf(writer, "%d:%d:%d:%s", r.Umask, cpu, r.OpenFiles, cmd.Path)
+	_ = writer.Close()
+	if err != nil {
+		_ = reader.Close()
+		return release, err
+	}
+	cmd.ExtraFiles = append([]*os.File{reader}, cmd.ExtraFiles...)
+	cmd.Args = append([]string{trampolineArg0}, cmd.Args...)
+	cmd.Path = exe
+	return func() { _ = reader.Close() }, nil
+}
+
+// Trampoline applies the umask and the resource limits of a script and
+// executes it, if the current process is started as a trampoline by a
+// restricted run. It returns at once otherwise, and should be called at the
+// beginning of main.
+func Trampoline() {
+	if len(os.Args) < 2 || os.Args[0] != trampolineArg0 {
+		return
+	}
+	err := trampoline()
+	_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err)
+	os.Exit(127)
+}
+
+func trampoline() error {
+	spec, err := readTrampolineSpec()
+	if err != nil {
+		return err
+	}
+	fields := strings.SplitN(spec, ":", 4)
+	if len(fields) != 4 {
+		return errors.New("invalid restrictions")
+	}
+	umask, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return err
+	}
+	cpu, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	openFiles, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return err
+	}
+	if umask >= 0 {
+		syscall.Umask(umask)
+	}
+	if cpu > 0 {
+		err = setrlimit(syscall.RLIMIT_CPU, cpu)
+		if err != nil {
+			return fmt.Errorf("failed to limit CPU time: %w", err)
+		}
+	}
+	if openFiles > 0 {
+		err = setrlimit(syscall.RLIMIT_NOFILE, openFiles)
+		if err != nil {
+			return fmt.Errorf("failed to limit open files: %w", err)
+		}
+	}
+	return syscall.Exec(fields[3], os.Args[1:], os.Environ())
+}
+
+// readTrampolineSpec reads the restrictions from the pipe passed by apply, and
+// closes it so that it is not inherited by the script.
+func readTrampolineSpec() (string, error) {
+	var stat syscall.Stat_t
+	err := syscall.Fstat(trampolineFD, &stat)
+	if err != nil || stat.Mode&syscall.S_IFMT != syscall.S_IFIFO {
+		return "", errors.New("restrictions not passed")
+	}
+	f := os.NewFile(trampolineFD, "restrictions")
+	defer f.Close()
+	spec, err := ioutil.ReadAll(io.LimitReader(f, 4096))
+	if err != nil {
+		return "", err
+	}
+	return string(spec), nil
+}
@@ -0,0 +1,27 @@
+package shell
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Validate checks that the restrictions are supported, which are only the
+// environment and the working directory on Windows.
+func (r *Restrictions) Validate() error {
+	if r.User != "" || r.Group != "" || r.Umask >= 0 || r.CPUTime > 0 || r.OpenFiles != 0 {
+		return errors.New("running scripts as another user or with a umask or resource limits is not supported on this platform")
+	}
+	return nil
+}
+
+func (r *Restrictions) apply(cmd *exec.Cmd) (release func(), err error) {
+	release = func() {}
+	err = r.Validate()
+	if err != nil {
+		return release, err
+	}
+	cmd.Dir = r.Dir
+	return release, nil
+}
+
+func Trampoline() {}
@@ -0,0 +1,10 @@
+//go:build !windows && !freebsd && !dragonfly
+// +build !windows,!freebsd,!dragonfly
+
+package shell
+
+import "syscall"
+
+func setrlimit(resource int, limit uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: limit, Max: limit})
+}
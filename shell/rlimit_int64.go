@@ -0,0 +1,10 @@
+//go:build freebsd || dragonfly
+// +build freebsd dragonfly
+
+package shell
+
+import "syscall"
+
+func setrlimit(resource int, limit uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: int64(limit), Max: int64(limit)})
+}
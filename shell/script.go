@@ -1,35 +1,123 @@
 package shell
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
+	"time"
 )
 
+// ErrorCodeTimeout is the error code returned when a script is terminated
+// because it does not exit within the timeout.
+const ErrorCodeTimeout = -2
+
+// DefaultGracePeriod is the time a script is given to exit after it is asked
+// to terminate, if not specified in the options.
+const DefaultGracePeriod = 5 * time.Second
+
+// Runner is a script or a command which can be run with options.
+type Runner interface {
+	RunContext(ctx context.Context, opts *Options) (errorCode int)
+}
+
 type Script string
 
+// Command is a program and its arguments, which is executed directly without
+// a shell.
+type Command []string
+
+// Options customize how a script is run.
+type Options struct {
+	// Env is added to the environment inherited from the current process.
+	Env []string
+	// Stdin is the standard input of the script, or os.Stdin if nil.
+	Stdin io.Reader
+	// Stdout and Stderr are where the output of the script is written, or
+	// os.Stdout and os.Stderr if nil.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Timeout is the time the script is allowed to run, or 0 for no limit.
+	Timeout time.Duration
+	// GracePeriod is the time between asking the script to terminate and
+	// killing it, or DefaultGracePeriod if 0.
+	GracePeriod time.Duration
+	// Restrictions reduce the privileges of the script if not nil.
+	Restrictions *Restrictions
+}
+
 func (s Script) Run() (errorCode int) {
-	args := append(strings.Split(Shell, " "), string(s))
-	cmd := exec.Command(args[0], args[1:]...)
+	return s.RunContext(context.Background(), nil)
+}
+
+// RunContext is like Run but runs the script with opts, which may be nil, and
+// terminates the script if the context is done before the script exits.
+func (s Script) RunContext(ctx context.Context, opts *Options) (errorCode int) {
+	return Command(s.args()).RunContext(ctx, opts)
+}
+
+func (c Command) Run() (errorCode int) {
+	return c.RunContext(context.Background(), nil)
+}
+
+// RunContext runs the command with opts, which may be nil, in a process group
+// of its own. The whole group is asked to terminate if the context is done or
+// the timeout elapses before the command exits, and is killed if it is still
+// running after the grace period.
+func (c Command) RunContext(ctx context.Context, opts *Options) (errorCode int) {
+	if len(c) == 0 {
+		return -1
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	cmd := exec.Command(c[0], c[1:]...)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	sigint := make(chan os.Signal)
-	closeChan := make(chan struct{})
-	go func() {
-		select {
-		case <-closeChan:
-			return
-		case <-sigint:
-			_ = cmd.Process.Signal(os.Interrupt)
+	cmd.Env = environ(opts.Restrictions, opts.Env)
+	if opts.Stdin != nil {
+		cmd.Stdin = opts.Stdin
+	}
+	if opts.Restrictions != nil {
+		release, err := opts.Restrictions.apply(cmd)
+		defer release()
+		if err != nil {
+			return -1
 		}
-	}()
-	signal.Notify(sigint, os.Interrupt)
-	defer signal.Reset(os.Interrupt)
-	defer close(closeChan)
-	err := cmd.Run()
+	}
+	stdout, err := newOutput(writerOr(opts.Stdout, os.Stdout))
+	if err != nil {
+		return -1
+	}
+	defer stdout.close(outputWaitDelay)
+	stderr, err := newOutput(writerOr(opts.Stderr, os.Stderr))
+	if err != nil {
+		stdout.started()
+		return -1
+	}
+	defer stderr.close(outputWaitDelay)
+	cmd.Stdout, cmd.Stderr = stdout.file, stderr.file
+	setProcessGroup(cmd)
+	g := newGroup(cmd)
+	defer forwardInterrupt(g)()
+	err = cmd.Start()
+	stdout.started()
+	stderr.started()
+	if err != nil {
+		return -1
+	}
+	exited := make(chan struct{})
+	timedOut := make(chan bool, 1)
+	go supervise(ctx, g, opts, exited, timedOut)
+	err = g.wait()
+	close(exited)
+	if <-timedOut {
+		return ErrorCodeTimeout
+	}
 	if err == nil {
 		return 0
 	}
@@ -40,36 +128,182 @@ func (s Script) Run() (errorCode int) {
 	return exitErr.ExitCode()
 }
 
+// supervise terminates the process group once the context is done or the
+// timeout elapses, unless exited is closed first, and reports on timedOut
+// whether the timeout elapsed. The group is killed after the grace period,
+// since the processes left in it may outlive the command itself.
+func supervise(ctx context.Context, g *group, opts *Options, exited chan struct{}, timedOut chan bool) {
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-exited:
+		timedOut <- false
+		return
+	case <-ctx.Done():
+		timedOut <- false
+	case <-timeout:
+		timedOut <- true
+	}
+	g.terminate()
+	gracePeriod := opts.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-exited:
+	case <-timer.C:
+		g.kill()
+	}
+}
+
+// group signals the process group of a command. The group is only signalled
+// until the command is reaped, since its process ID, which is also the ID of
+// the group, may be reused afterwards.
+type group struct {
+	cmd         *exec.Cmd
+	mutex       sync.Mutex
+	reaped      bool
+	terminating bool
+	killed      chan struct{}
+}
+
+func newGroup(cmd *exec.Cmd) *group {
+	return &group{cmd: cmd, killed: make(chan struct{})}
+}
+
+func (g *group) signal(signal func(cmd *exec.Cmd)) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.reaped {
+		signal(g.cmd)
+	}
+}
+
+// terminate asks the group to terminate, after which the command is not
+// reaped until the group is killed.
+func (g *group) terminate() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.reaped {
+		g.terminating = true
+		terminateGroup(g.cmd)
+	}
+}
+
+// kill kills the group once the grace period after terminate elapses.
+func (g *group) kill() {
+	g.signal(killGroup)
+	close(g.killed)
+}
+
+// wait waits for the command to exit and reaps it. Where the exit can be
+// waited for without reaping the command, the group stops being signalled
+// before the command is reaped, and a command asked to terminate is only
+// reaped once the group is killed. Otherwise the group stops being signalled
+// right after the command is reaped.
+func (g *group) wait() error {
+	if !waitExited(g.cmd) {
+		err := g.cmd.Wait()
+		g.setReaped()
+		return err
+	}
+	g.mutex.Lock()
+	terminating := g.terminating
+	if !terminating {
+		g.reaped = true
+	}
+	g.mutex.Unlock()
+	if terminating {
+		<-g.killed
+		g.setReaped()
+	}
+	return g.cmd.Wait()
+}
+
+func (g *group) setReaped() {
+	g.mutex.Lock()
+	g.reaped = true
+	g.mutex.Unlock()
+}
+
+func writerOr(w, defaultWriter io.Writer) io.Writer {
+	if w == nil {
+		return defaultWriter
+	}
+	return w
+}
+
+func (c Command) String() string {
+	return Join(c)
+}
+
 func (s Script) Eval() (output string) {
-	args := append(strings.Split(Shell, " "), string(s))
-	cmd := exec.Command(args[0], args[1:]...)
-	reader, err := cmd.StdoutPipe()
+	output, _ = Output(context.Background(), s, nil)
+	return output
+}
+
+// Output runs r like RunContext, and returns its standard output instead of
+// writing it to opts.Stdout.
+func Output(ctx context.Context, r Runner, opts *Options) (output string, errorCode int) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	var buffer bytes.Buffer
+	o.Stdout = &buffer
+	errorCode = r.RunContext(ctx, &o)
+	return buffer.String(), errorCode
+}
+
+// shellWords is the shell and its arguments set with SetShell, or nil for the
+// default Shell.
+var shellWords []string
+
+// SetShell sets the shell and the arguments the scripts are run with, which
+// are parsed as shell words, or split on spaces on Windows.
+func SetShell(s string) error {
+	words, err := splitShell(s)
 	if err != nil {
-		return ""
+		return err
 	}
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	sigint := make(chan os.Signal)
+	if len(words) == 0 {
+		return errors.New("no shell specified")
+	}
+	Shell, shellWords = s, words
+	return nil
+}
+
+// args returns the shell and its arguments followed by the script.
+func (s Script) args() []string {
+	words := shellWords
+	if words == nil {
+		words = strings.Fields(Shell)
+	}
+	return append(append([]string(nil), words...), string(s))
+}
+
+// forwardInterrupt forwards SIGINT received by the current process to the
+// process group g once it is started, until the returned function is called.
+func forwardInterrupt(g *group) (stop func()) {
+	sigint := make(chan os.Signal, 1)
 	closeChan := make(chan struct{})
 	go func() {
 		select {
 		case <-closeChan:
 			return
 		case <-sigint:
-			_ = cmd.Process.Signal(os.Interrupt)
+			g.signal(interruptGroup)
 		}
 	}()
 	signal.Notify(sigint, os.Interrupt)
-	defer signal.Reset(os.Interrupt)
-	defer close(closeChan)
-	err = cmd.Start()
-	if err != nil {
-		return ""
-	}
-	bytes, err := io.ReadAll(reader)
-	if err != nil {
-		return ""
+	return func() {
+		signal.Stop(sigint)
+		close(closeChan)
 	}
-	_ = cmd.Wait()
-	return string(bytes)
 }
@@ -0,0 +1,103 @@
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetShell(t *testing.T) {
+	oldShell, oldWords := Shell, shellWords
+	defer func() {
+		Shell, shellWords = oldShell, oldWords
+	}()
+	tests := []struct {
+		shell   string
+		want    []string
+		wantErr bool
+	}{
+		{"bash -c", []string{"bash", "-c", "echo"}, false},
+		{`"/opt/my shell/bin/sh" -e -c`, []string{"/opt/my shell/bin/sh", "-e", "-c", "echo"}, false},
+		{`env 'A=1 2' sh -c`, []string{"env", "A=1 2", "sh", "-c", "echo"}, false},
+		{`"sh -c`, nil, true},
+		{"  ", nil, true},
+	}
+	for _, test := range tests {
+		Shell, shellWords = oldShell, oldWords
+		err := SetShell(test.shell)
+		if (err != nil) != test.wantErr {
+			t.Errorf("SetShell(%q) error = %v, want error %t", test.shell, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := Script("echo").args(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("after SetShell(%q), args = %q, want %q", test.shell, got, test.want)
+		}
+	}
+}
+
+// alive reports whether the process pid is running, which excludes zombies.
+func alive(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// The state follows the command name in parentheses.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestRunContextTimeout(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"leader ignores termination", `trap "" TERM; echo $$; while :; do sleep 1; done`},
+		{"child ignores termination", `(trap "" TERM; exec sleep 37) & echo $!; wait`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &Options{Timeout: 300 * time.Millisecond, GracePeriod: 500 * time.Millisecond}
+			start := time.Now()
+			output, errorCode := Output(context.Background(), Script(test.script), opts)
+			if errorCode != ErrorCodeTimeout {
+				t.Errorf("error code = %d, want %d", errorCode, ErrorCodeTimeout)
+			}
+			if d := time.Since(start); d < opts.Timeout+opts.GracePeriod {
+				t.Errorf("returned after %s, before the grace period elapsed", d)
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(output))
+			if err != nil {
+				t.Fatalf("output = %q, want a process ID", output)
+			}
+			for deadline := time.Now().Add(time.Second); alive(pid); time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatalf("process %d is still running", pid)
+				}
+			}
+		})
+	}
+}
+
+func TestRunContextExit(t *testing.T) {
+	opts := &Options{Timeout: 5 * time.Second, GracePeriod: 5 * time.Second}
+	start := time.Now()
+	if errorCode := Script("exit 3").RunContext(context.Background(), opts); errorCode != 3 {
+		t.Errorf("error code = %d, want 3", errorCode)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("returned after %s, want at once", d)
+	}
+}
@@ -3,3 +3,8 @@
 package shell
 
 var Shell = "sh -c"
+
+// splitShell splits the shell and its arguments as shell words.
+func splitShell(s string) ([]string, error) {
+	return Split(s)
+}
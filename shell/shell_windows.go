@@ -1,3 +1,13 @@
 package shell
 
+import (
+	"strings"
+)
+
 var Shell = "cmd.exe /c"
+
+// splitShell splits the shell and its arguments on spaces, since backslashes
+// are path separators rather than escapes on Windows.
+func splitShell(s string) ([]string, error) {
+	return strings.Fields(s), nil
+}
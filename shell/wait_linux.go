@@ -0,0 +1,22 @@
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+const pPID = 1
+
+// waitExited waits for the process of the started cmd to exit without reaping
+// it, and reports whether it did so.
+func waitExited(cmd *exec.Cmd) bool {
+	// Large enough for the siginfo_t structure filled in by waitid.
+	var siginfo [128]byte
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(cmd.Process.Pid), uintptr(unsafe.Pointer(&siginfo[0])), syscall.WEXITED|syscall.WNOWAIT, 0, 0)
+		if errno != syscall.EINTR {
+			return errno == 0
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package shell
+
+import (
+	"os/exec"
+)
+
+// waitExited reports false, as the exit of a process cannot be waited for
+// without reaping it on this platform.
+func waitExited(cmd *exec.Cmd) bool {
+	return false
+}
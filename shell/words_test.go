@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  \t\n", nil, false},
+		{"curl -s https://example.com", []string{"curl", "-s", "https://example.com"}, false},
+		{"  a   b  ", []string{"a", "b"}, false},
+		{"'a b' c", []string{"a b", "c"}, false},
+		{`"a b" c`, []string{"a b", "c"}, false},
+		{`'a\b'`, []string{`a\b`}, false},
+		{`"a\b"`, []string{`a\b`}, false},
+		{`"a\"b\\c\$d"`, []string{`a"b\c$d`}, false},
+		{`a\ b`, []string{"a b"}, false},
+		{`a\\b`, []string{`a\b`}, false},
+		{"a\\\nb", []string{"ab"}, false},
+		{`a'b'"c"d`, []string{"abcd"}, false},
+		{`'' ""`, []string{"", ""}, false},
+		{`'it'\''s'`, []string{"it's"}, false},
+		{`a\`, []string{"a"}, false},
+		{`'a`, nil, true},
+		{`"a`, nil, true},
+		{`"a\"`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := Split(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Split(%q) error = %v, want error %t", test.s, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Split(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"curl", "-s", "https://example.com/update?a=1"}, "curl -s 'https://example.com/update?a=1'"},
+		{[]string{""}, "''"},
+		{[]string{"a b"}, "'a b'"},
+		{[]string{"it's"}, `'it'\''s'`},
+		{[]string{`a\b`, `$HOME`, `"`}, `'a\b' '$HOME' '"'`},
+	}
+	for _, test := range tests {
+		got := Join(test.words)
+		if got != test.want {
+			t.Errorf("Join(%q) = %q, want %q", test.words, got, test.want)
+		}
+		if len(test.words) == 0 {
+			continue
+		}
+		words, err := Split(got)
+		if err != nil || !reflect.DeepEqual(words, test.words) {
+			t.Errorf("Split(Join(%q)) = %q, %v, want the same words", test.words, words, err)
+		}
+	}
+}
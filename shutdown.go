@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"github.com/zhouchenh/active-ddns/logger"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// scriptGuard keeps track of the running scripts, so that they can be
+// terminated before the client exits.
+type scriptGuard struct {
+	mutex   sync.Mutex
+	done    chan struct{}
+	closing bool
+	running sync.WaitGroup
+}
+
+var scripts = &scriptGuard{done: make(chan struct{})}
+
+// begin registers a script about to be run, and returns a context derived
+// from ctx which is also done on shutdown, and the function to be called once
+// the script exits. It returns false if the client is shutting down.
+func (g *scriptGuard) begin(ctx context.Context) (context.Context, func(), bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closing {
+		return nil, nil, false
+	}
+	g.running.Add(1)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-g.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		g.running.Done()
+	}, true
+}
+
+// shutdown terminates the running scripts and waits for them to exit.
+func (g *scriptGuard) shutdown() {
+	g.mutex.Lock()
+	g.closing = true
+	close(g.done)
+	g.mutex.Unlock()
+	g.running.Wait()
+}
+
+// handleShutdown waits for SIGINT or SIGTERM, and exits with code once the
+// running scripts are terminated.
+func handleShutdown(code int) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	logger.Info().Str("signal", sig.String()).Msg("Shutting down")
+	scripts.shutdown()
+	os.Exit(code)
+}
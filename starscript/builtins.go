@@ -0,0 +1,244 @@
+package starscript
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/zhouchenh/active-ddns/logger"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	httpTimeout   = 30 * time.Second
+	lookupTimeout = 5 * time.Second
+	// maxReadSize is the maximal size of a response body or a file read by a
+	// script.
+	maxReadSize = 1 << 20
+)
+
+var builtins = starlark.StringDict{
+	"http": &starlarkstruct.Module{
+		Name: "http",
+		Members: starlark.StringDict{
+			"get":     starlark.NewBuiltin("http.get", httpGet),
+			"post":    starlark.NewBuiltin("http.post", httpPost),
+			"request": starlark.NewBuiltin("http.request", httpRequest),
+		},
+	},
+	"dns": &starlarkstruct.Module{
+		Name: "dns",
+		Members: starlark.StringDict{
+			"lookup": starlark.NewBuiltin("dns.lookup", dnsLookup),
+		},
+	},
+	"log": &starlarkstruct.Module{
+		Name: "log",
+		Members: starlark.StringDict{
+			"debug":   starlark.NewBuiltin("log.debug", logFunc(logger.Debug)),
+			"info":    starlark.NewBuiltin("log.info", logFunc(logger.Info)),
+			"warning": starlark.NewBuiltin("log.warning", logFunc(logger.Warning)),
+			"error":   starlark.NewBuiltin("log.error", logFunc(logger.Error)),
+		},
+	},
+	"json":      starlarkjson.Module,
+	"read_file": starlark.NewBuiltin("read_file", readFile),
+}
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// httpGet implements http.get(url, headers=None).
+func httpGet(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url string
+	var headers *starlark.Dict
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &url, "headers?", &headers)
+	if err != nil {
+		return nil, err
+	}
+	return doRequest(thread, "GET", url, "", headers)
+}
+
+// httpPost implements http.post(url, body="", headers=None).
+func httpPost(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url, body string
+	var headers *starlark.Dict
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &url, "body?", &body, "headers?", &headers)
+	if err != nil {
+		return nil, err
+	}
+	return doRequest(thread, "POST", url, body, headers)
+}
+
+// httpRequest implements http.request(method, url, body="", headers=None).
+func httpRequest(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var method, url, body string
+	var headers *starlark.Dict
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "method", &method, "url", &url, "body?", &body, "headers?", &headers)
+	if err != nil {
+		return nil, err
+	}
+	return doRequest(thread, strings.ToUpper(method), url, body, headers)
+}
+
+// doRequest sends an HTTP request, and returns a struct of the status code,
+// the headers and the body of the response.
+func doRequest(thread *starlark.Thread, method, url, body string, headers *starlark.Dict) (starlark.Value, error) {
+	request, err := http.NewRequestWithContext(threadContext(thread), method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if headers != nil {
+		for _, item := range headers.Items() {
+			name, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("header name %s is not a string", item[0])
+			}
+			value, ok := starlark.AsString(item[1])
+			if !ok {
+				return nil, fmt.Errorf("value of header %s is not a string", name)
+			}
+			request.Header.Set(name, value)
+		}
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := readAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	responseHeaders := starlark.NewDict(len(response.Header))
+	for name := range response.Header {
+		_ = responseHeaders.SetKey(starlark.String(name), starlark.String(response.Header.Get(name)))
+	}
+	return starlarkstruct.FromStringDict(starlark.String("response"), starlark.StringDict{
+		"status":  starlark.MakeInt(response.StatusCode),
+		"headers": responseHeaders,
+		"body":    starlark.String(data),
+	}), nil
+}
+
+// dnsLookup implements dns.lookup(name, family=""), which returns the list of
+// the addresses of name, of the family "ipv4" or "ipv6" if specified.
+func dnsLookup(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, family string
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "family?", &family)
+	if err != nil {
+		return nil, err
+	}
+	network := "ip"
+	switch family {
+	case "":
+	case "ipv4":
+		network = "ip4"
+	case "ipv6":
+		network = "ip6"
+	default:
+		return nil, fmt.Errorf("%s: undefined family %q", b.Name(), family)
+	}
+	ctx, cancel := context.WithTimeout(threadContext(thread), lookupTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, name)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]starlark.Value, len(ips))
+	for i, ip := range ips {
+		addresses[i] = starlark.String(ip.String())
+	}
+	return starlark.NewList(addresses), nil
+}
+
+// logFunc returns the implementation of log.<level>(msg, **fields).
+func logFunc(level func() *zerolog.Event) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var msg string
+		err := starlark.UnpackPositionalArgs(b.Name(), args, nil, 1, &msg)
+		if err != nil {
+			return nil, err
+		}
+		event := level().Str("script", thread.Name)
+		for _, kwarg := range kwargs {
+			name := string(kwarg[0].(starlark.String))
+			if value, ok := starlark.AsString(kwarg[1]); ok {
+				event = event.Str(name, value)
+			} else {
+				event = event.Str(name, kwarg[1].String())
+			}
+		}
+		event.Msg(msg)
+		return starlark.None, nil
+	}
+}
+
+// readFile implements read_file(path), which reads a file in the directory
+// passed to Load. A relative path is relative to the directory.
+func readFile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &path)
+	if err != nil {
+		return nil, err
+	}
+	dir, _ := thread.Local(dirKey).(string)
+	if dir == "" {
+		return nil, fmt.Errorf("%s: no directory is allowed to be read", b.Name())
+	}
+	path, err = resolveInDir(dir, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := readAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(data), nil
+}
+
+// resolveInDir resolves path relative to dir and the symbolic links in it,
+// and fails if the file is not in dir.
+func resolveInDir(dir, path string) (string, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not in %s", path, dir)
+	}
+	return resolved, nil
+}
+
+// readAll reads r up to maxReadSize bytes, and fails if there is more.
+func readAll(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxReadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReadSize {
+		return nil, fmt.Errorf("more than %d bytes to read", maxReadSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,106 @@
+// Package starscript runs update logic written in Starlark, a dialect of
+// Python, without a shell. A script defines on_update(event), and has no
+// access to the host other than the builtins http, dns, json, log and
+// read_file, which only reads the files in the directory passed to Load, the
+// one specified with -scriptdir.
+package starscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zhouchenh/active-ddns/logger"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// maxExecutionSteps bounds the computation of the top level of a script and of
+// a call, so that a script stuck in a loop does not block the updates forever.
+const maxExecutionSteps = 100000000
+
+const (
+	contextKey = "context"
+	dirKey     = "dir"
+)
+
+type Script struct {
+	filename string
+	dir      string
+	onUpdate starlark.Callable
+}
+
+// Load runs the top level of the script in filename, and checks that it
+// defines on_update. read_file may only read the files in dir, or no file if
+// dir is empty.
+func Load(filename, dir string) (*Script, error) {
+	s := &Script{filename: filename, dir: dir}
+	thread := s.newThread(context.Background())
+	globals, err := starlark.ExecFile(thread, filename, nil, builtins)
+	if err != nil {
+		return nil, evalError(err)
+	}
+	onUpdate, ok := globals["on_update"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: on_update is not defined as a function", filename)
+	}
+	s.onUpdate = onUpdate
+	return s, nil
+}
+
+// OnUpdate calls on_update with a struct of the fields of event, and returns
+// an error if it fails or returns False. The call is cancelled once the
+// context is done.
+func (s *Script) OnUpdate(ctx context.Context, event map[string]string) error {
+	thread := s.newThread(ctx)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-stop:
+		}
+	}()
+	fields := make(starlark.StringDict, len(event))
+	for name, value := range event {
+		fields[name] = starlark.String(value)
+	}
+	args := starlark.Tuple{starlarkstruct.FromStringDict(starlark.String("event"), fields)}
+	result, err := starlark.Call(thread, s.onUpdate, args, nil)
+	if err != nil {
+		return evalError(err)
+	}
+	if result == starlark.False {
+		return errors.New("on_update returned False")
+	}
+	return nil
+}
+
+func (s *Script) newThread(ctx context.Context) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.filename,
+		Print: func(_ *starlark.Thread, msg string) {
+			logger.Info().Str("script", s.filename).Msg(msg)
+		},
+	}
+	thread.SetLocal(contextKey, ctx)
+	thread.SetLocal(dirKey, s.dir)
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+	return thread
+}
+
+func threadContext(thread *starlark.Thread) context.Context {
+	if ctx, ok := thread.Local(contextKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// evalError returns the error with the Starlark backtrace if there is one.
+func evalError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package starscript
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeScript writes a script with source to a temporary directory, and
+// returns its path.
+func writeScript(t *testing.T, source string) string {
+	filename := filepath.Join(t.TempDir(), "update.star")
+	err := os.WriteFile(filename, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestOnUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"returns None", "def on_update(event):\n    pass\n", false},
+		{"returns True", "def on_update(event):\n    return True\n", false},
+		{"returns False", "def on_update(event):\n    return False\n", true},
+		{"reads event", "def on_update(event):\n    return event.ip == \"192.0.2.1\" and event.family == \"ipv4\"\n", false},
+		{"fails", "def on_update(event):\n    fail(\"update failed\")\n", true},
+		{"uses json", "def on_update(event):\n    return json.decode(json.encode({\"ip\": event.ip}))[\"ip\"] == event.ip\n", false},
+	}
+	event := map[string]string{"ip": "192.0.2.1", "family": "ipv4"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := Load(writeScript(t, test.source), "")
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			err = s.OnUpdate(context.Background(), event)
+			if (err != nil) != test.wantErr {
+				t.Errorf("OnUpdate() error = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"defines on_update", "def on_update(event):\n    pass\n", false},
+		{"no on_update", "x = 1\n", true},
+		{"on_update is not a function", "on_update = 1\n", true},
+		{"syntax error", "def on_update(event)\n", true},
+		{"fails at top level", "fail(\"broken\")\n", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(writeScript(t, test.source), "")
+			if (err != nil) != test.wantErr {
+				t.Errorf("Load() error = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestOnUpdateCancelled(t *testing.T) {
+	s, err := Load(writeScript(t, "def on_update(event):\n    for i in range(1000000000):\n        pass\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = s.OnUpdate(ctx, nil)
+	if err == nil {
+		t.Fatal("OnUpdate() error = nil, want an error once cancelled")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("OnUpdate() returned after %s, want soon after the cancellation", d)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "token"), []byte("secret"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	err = os.WriteFile(filepath.Join(outside, "other"), []byte("other"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(outside, "other"), filepath.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir     string
+		path    string
+		wantErr bool
+	}{
+		{dir, "token", false},
+		{dir, filepath.Join(dir, "token"), false},
+		{dir, "missing", true},
+		{dir, "../" + filepath.Base(outside) + "/other", true},
+		{dir, filepath.Join(outside, "other"), true},
+		{dir, "link", true},
+		{"", "token", true},
+	}
+	for _, test := range tests {
+		s, err := Load(writeScript(t, "def on_update(event):\n    return read_file(event.path) == \"secret\"\n"), test.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.OnUpdate(context.Background(), map[string]string{"path": test.path})
+		if (err != nil) != test.wantErr {
+			t.Errorf("read_file(%q) in %q error = %v, want error %t", test.path, test.dir, err, test.wantErr)
+		}
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{0, false},
+		{1, false},
+		{maxReadSize, false},
+		{maxReadSize + 1, true},
+		{2 * maxReadSize, true},
+	}
+	for _, test := range tests {
+		data, err := readAll(bytes.NewReader(make([]byte, test.size)))
+		if (err != nil) != test.wantErr {
+			t.Errorf("readAll() of %d bytes error = %v, want error %t", test.size, err, test.wantErr)
+			continue
+		}
+		if err == nil && len(data) != test.size {
+			t.Errorf("readAll() of %d bytes read %d bytes", test.size, len(data))
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"github.com/zhouchenh/active-ddns/client"
+	"github.com/zhouchenh/active-ddns/server"
+	"net"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type templateData struct {
+	Event    string
+	IP       string
+	OldIP    string
+	Family   string
+	Host     string
+	Server   string
+	Port     string
+	Client   string
+	Time     time.Time
+	Duration string
+	Error    string
+}
+
+var templateFuncs = template.FuncMap{
+	"reverse": reverseName,
+	"prefix":  prefixOf,
+}
+
+func newTemplateData(u *client.Update) *templateData {
+	data := &templateData{
+		Event:  "update",
+		Family: u.Family,
+		Host:   u.Host,
+		Time:   u.Time,
+	}
+	if u.IPAddr != nil {
+		data.IP = u.IPAddr.String()
+	}
+	if u.OldIPAddr != nil {
+		data.OldIP = u.OldIPAddr.String()
+	}
+	data.Server, data.Port = splitHostPort(u.Server)
+	return data
+}
+
+// newEventData returns the template data of an event, which is the data of
+// the update with the event fields set.
+func newEventData(e *client.Event) *templateData {
+	data := newTemplateData(&e.Update)
+	data.Event = e.Type
+	if e.Duration > 0 {
+		data.Duration = e.Duration.String()
+	}
+	if e.Err != nil {
+		data.Error = e.Err.Error()
+	}
+	return data
+}
+
+// sampleUpdate returns an update used to check templates for errors before
+// they are used.
+func sampleUpdate() *client.Update {
+	return &client.Update{
+		Family:    "ipv4",
+		IPAddr:    net.IPv4(192, 0, 2, 2),
+		OldIPAddr: net.IPv4(192, 0, 2, 1),
+		Server:    "example.com:0",
+		Time:      time.Now(),
+	}
+}
+
+// newSessionData returns the template data of an event of a session of a
+// client with the server.
+func newSessionData(event string, s *server.Session) *templateData {
+	data := &templateData{
+		Event:  event,
+		IP:     s.IPAddr.String(),
+		Family: client.Family(s.IPAddr),
+		Client: s.Identity,
+		Time:   time.Now(),
+	}
+	if event == client.EventDisconnected {
+		data.Duration = data.Time.Sub(s.Connected).String()
+	}
+	return data
+}
+
+// scriptEnv returns the environment variables describing the update or the
+// event which are passed to the script.
+func scriptEnv(data *templateData) []string {
+	return []string{
+		"ACTIVE_DDNS_EVENT=" + data.Event,
+		"ACTIVE_DDNS_IP=" + data.IP,
+		"ACTIVE_DDNS_OLD_IP=" + data.OldIP,
+		"ACTIVE_DDNS_FAMILY=" + data.Family,
+		"ACTIVE_DDNS_HOST=" + data.Host,
+		"ACTIVE_DDNS_SERVER=" + data.Server,
+		"ACTIVE_DDNS_PORT=" + data.Port,
+		"ACTIVE_DDNS_CLIENT=" + data.Client,
+		"ACTIVE_DDNS_TIME=" + data.Time.Format(time.RFC3339),
+		"ACTIVE_DDNS_DURATION=" + data.Duration,
+		"ACTIVE_DDNS_ERROR=" + data.Error,
+	}
+}
+
+// updateFields returns the fields of the event passed to the Starlark
+// on_update function.
+func updateFields(data *templateData, updateID string) map[string]string {
+	return map[string]string{
+		"id":       updateID,
+		"event":    data.Event,
+		"ip":       data.IP,
+		"old_ip":   data.OldIP,
+		"family":   data.Family,
+		"host":     data.Host,
+		"server":   data.Server,
+		"port":     data.Port,
+		"time":     data.Time.Format(time.RFC3339),
+		"duration": data.Duration,
+		"error":    data.Error,
+	}
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func execTemplate(t *template.Template, data *templateData) (string, error) {
+	builder := strings.Builder{}
+	err := t.Execute(&builder, data)
+	return builder.String(), err
+}
+
+// reverseName returns the name of the PTR record of address, such as
+// 4.3.2.1.in-addr.arpa for 1.2.3.4.
+func reverseName(address string) (string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", address)
+	}
+	builder := strings.Builder{}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		for i := len(ipv4) - 1; i >= 0; i-- {
+			builder.WriteString(fmt.Sprintf("%d.", ipv4[i]))
+		}
+		builder.WriteString("in-addr.arpa")
+		return builder.String(), nil
+	}
+	for i := len(ip) - 1; i >= 0; i-- {
+		builder.WriteString(fmt.Sprintf("%x.%x.", ip[i]&0xf, ip[i]>>4))
+	}
+	builder.WriteString("ip6.arpa")
+	return builder.String(), nil
+}
+
+// prefixOf returns the network of address with the prefix length in CIDR
+// notation, such as 2001:db8:1:2::/64. It is meant to be used in a pipeline,
+// such as {{.IP | prefix 64}}.
+func prefixOf(length int, address string) (string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", address)
+	}
+	bits := 8 * net.IPv6len
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip, bits = ipv4, 8*net.IPv4len
+	}
+	if length < 0 || length > bits {
+		return "", fmt.Errorf("invalid prefix length %d", length)
+	}
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(length, bits)), Mask: net.CIDRMask(length, bits)}
+	return network.String(), nil
+}
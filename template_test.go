@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa", false},
+		{"10.0.0.255", "255.0.0.10.in-addr.arpa", false},
+		{"::ffff:192.0.2.1", "1.2.0.192.in-addr.arpa", false},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", false},
+		{"2001:db8:1:2:11:22ff:fe33:4455", "5.5.4.4.3.3.e.f.f.f.2.2.1.1.0.0.2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", false},
+		{"", "", true},
+		{"not-an-address", "", true},
+	}
+	for _, test := range tests {
+		got, err := reverseName(test.address)
+		if (err != nil) != test.wantErr {
+			t.Errorf("reverseName(%q) error = %v, want error %t", test.address, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("reverseName(%q) = %q, want %q", test.address, got, test.want)
+		}
+	}
+}
+
+func TestPrefixOf(t *testing.T) {
+	tests := []struct {
+		length  int
+		address string
+		want    string
+		wantErr bool
+	}{
+		{64, "2001:db8:1:2:11:22ff:fe33:4455", "2001:db8:1:2::/64", false},
+		{56, "2001:db8:1:abcd::1", "2001:db8:1:ab00::/56", false},
+		{128, "2001:db8::1", "2001:db8::1/128", false},
+		{0, "2001:db8::1", "::/0", false},
+		{24, "192.0.2.1", "192.0.2.0/24", false},
+		{32, "192.0.2.1", "192.0.2.1/32", false},
+		{24, "::ffff:192.0.2.1", "192.0.2.0/24", false},
+		{33, "192.0.2.1", "", true},
+		{129, "2001:db8::1", "", true},
+		{-1, "2001:db8::1", "", true},
+		{64, "not-an-address", "", true},
+	}
+	for _, test := range tests {
+		got, err := prefixOf(test.length, test.address)
+		if (err != nil) != test.wantErr {
+			t.Errorf("prefixOf(%d, %q) error = %v, want error %t", test.length, test.address, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("prefixOf(%d, %q) = %q, want %q", test.length, test.address, got, test.want)
+		}
+	}
+}
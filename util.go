@@ -1,6 +1,11 @@
 package main
 
-import "strings"
+import (
+	"errors"
+	"github.com/zhouchenh/active-ddns/client"
+	"net"
+	"strings"
+)
 
 // Copied from net/url/url.go
 // Copyright 2009 The Go Authors. All rights reserved.
@@ -32,3 +37,45 @@ func validOptionalPort(port string) bool {
 	}
 	return true
 }
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHosts parses a comma-separated list of hostname=interface-identifier
+// entries, such as "nas.example.com=::11:22ff:fe33:4455".
+func parseHosts(s string) (hosts []client.Host, err error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		name, interfaceID := splitHostEntry(strings.TrimSpace(entry))
+		ip := net.ParseIP(interfaceID)
+		if name == "" || ip == nil || ip.To4() != nil {
+			return nil, errors.New("invalid host entry \"" + entry + "\"")
+		}
+		hosts = append(hosts, client.Host{Name: name, InterfaceID: ip})
+	}
+	return hosts, nil
+}
+
+func splitHostEntry(entry string) (name, interfaceID string) {
+	equal := strings.IndexByte(entry, '=')
+	if equal == -1 {
+		return "", ""
+	}
+	return strings.TrimSpace(entry[:equal]), strings.TrimSpace(entry[equal+1:])
+}
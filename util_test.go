@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"nas.example.com=::11:22ff:fe33:4455", map[string]string{"nas.example.com": "::11:22ff:fe33:4455"}, false},
+		{" nas.example.com = ::11 , tv.example.com=::12 ", map[string]string{"nas.example.com": "::11", "tv.example.com": "::12"}, false},
+		{"nas.example.com", nil, true},
+		{"=::11", nil, true},
+		{"nas.example.com=", nil, true},
+		{"nas.example.com=192.0.2.1", nil, true},
+		{"nas.example.com=not-an-address", nil, true},
+		{"nas.example.com=::11,", nil, true},
+	}
+	for _, test := range tests {
+		hosts, err := parseHosts(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseHosts(%q) error = %v, want error %t", test.s, err, test.wantErr)
+			continue
+		}
+		if len(hosts) != len(test.want) {
+			t.Errorf("parseHosts(%q) = %v, want %v", test.s, hosts, test.want)
+			continue
+		}
+		for _, host := range hosts {
+			if want, ok := test.want[host.Name]; !ok || host.InterfaceID.String() != want {
+				t.Errorf("parseHosts(%q) returned %s=%s, want %v", test.s, host.Name, host.InterfaceID, test.want)
+			}
+		}
+	}
+}